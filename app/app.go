@@ -0,0 +1,375 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/walletYabPangu/shared/config"
+	"github.com/walletYabPangu/shared/metrics"
+	"github.com/walletYabPangu/shared/pkg/cache"
+	"github.com/walletYabPangu/shared/pkg/database"
+	"github.com/walletYabPangu/shared/pkg/logger"
+	"github.com/walletYabPangu/shared/pkg/middleware"
+	"github.com/walletYabPangu/shared/pkg/redis"
+	"gorm.io/gorm"
+)
+
+// App holds the dependencies every service builds from Config and
+// owns their lifecycle: Run starts the HTTP server, the metrics server
+// and registered workers, and shuts everything down on SIGINT/SIGTERM.
+type App struct {
+	Config *config.Config
+	Logger *logger.Logger
+	DB     *gorm.DB
+	Redis  *redis.Client
+	Cache  *cache.Cache
+	// Metrics are labelled with the service and served from Registry,
+	// with the Go runtime and process metrics, by the metrics server.
+	// The global registry behind metrics.Default is not served: its
+	// metrics share names with these when METRICS_NAMESPACE is empty.
+	Metrics  *metrics.Metrics
+	Registry *prometheus.Registry
+
+	handler http.Handler
+	workers []worker
+	hooks   []hook
+
+	server        *http.Server
+	metricsServer *http.Server
+	adminServer   *http.Server
+	telegram      *logger.Telegram
+	unsubscribe   func()
+	watchConfig   bool
+
+	cancelWorkers context.CancelFunc
+	workersDone   sync.WaitGroup
+	shutdownOnce  sync.Once
+	shutdownErr   error
+}
+
+type worker struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type options struct {
+	config     *config.Config
+	configOpts []config.Option
+	noDB       bool
+	noRedis    bool
+}
+
+type Option func(*options)
+
+// WithConfig uses cfg instead of loading the configuration
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) { o.config = cfg }
+}
+
+// WithConfigOptions are passed to config.Load
+func WithConfigOptions(opts ...config.Option) Option {
+	return func(o *options) { o.configOpts = append(o.configOpts, opts...) }
+}
+
+// WithoutDatabase skips Postgres for services that don't use it
+func WithoutDatabase() Option {
+	return func(o *options) { o.noDB = true }
+}
+
+// WithoutRedis skips Redis and the cache
+func WithoutRedis() Option {
+	return func(o *options) { o.noRedis = true }
+}
+
+// configWatchInterval is how often Run checks the config file
+const configWatchInterval = 10 * time.Second
+
+// New loads the configuration and connects to Postgres and Redis.
+// Whatever was opened is closed again if a later step fails.
+func New(opts ...Option) (*App, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg := o.config
+	if cfg == nil {
+		loaded, err := config.Load(o.configOpts...)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+	// Metrics, logs and service tokens are labelled with it
+	if cfg.Service.Name == "" {
+		return nil, config.Errors{{Env: "SERVICE_NAME", Message: "is required"}}
+	}
+
+	// Only a configuration loaded here follows its file
+	a := &App{Config: cfg, watchConfig: o.config == nil}
+	var logOpts []logger.Option
+	if tgCfg, ok := logger.TelegramConfigFrom(cfg.Service, cfg.Bot); ok {
+		tg, err := logger.NewTelegram(tgCfg)
+		if err != nil {
+			return nil, fmt.Errorf("app: %w", err)
+		}
+		a.telegram = tg
+		logOpts = append(logOpts, logger.WithTelegram(tg))
+	}
+	log, err := logger.NewFromConfig(cfg.Service, cfg.Log, logOpts...)
+	if err != nil {
+		if a.telegram != nil {
+			_ = a.telegram.Close()
+		}
+		return nil, fmt.Errorf("app: %w", err)
+	}
+	a.Logger = log
+	a.Registry = prometheus.NewRegistry()
+	a.Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	a.Metrics = metrics.New(a.Registry, cfg.Metrics.Namespace, cfg.Service.Name)
+
+	if !o.noDB {
+		db, err := database.NewGORM(cfg.Database, database.WithLogger(a.Logger))
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("app: database: %w", err)
+		}
+		a.DB = db
+	}
+
+	if !o.noRedis {
+		client, err := redis.New(cfg.Redis)
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("app: redis: %w", err)
+		}
+		a.Redis = client
+		a.Cache = cache.New(client)
+	}
+
+	a.unsubscribe = config.Subscribe(a.reload)
+	return a, nil
+}
+
+// reload applies reloadable settings to the logger and live connections
+func (a *App) reload(old, current *config.Config) {
+	if err := a.Logger.ApplyConfig(current.Log); err != nil {
+		a.Logger.Errorw("apply log config", "error", err)
+	}
+	o, c := old.Database, current.Database
+	if a.DB != nil && (o.MaxIdleConns != c.MaxIdleConns || o.MaxOpenConns != c.MaxOpenConns || o.ConnMaxLifetime != c.ConnMaxLifetime) {
+		if err := database.ApplyPoolSettings(a.DB, current.Database); err != nil {
+			a.Logger.Errorw("apply pool settings", "error", err)
+		}
+	}
+}
+
+// Handle sets the handler served on HTTP_ADDR by Run, wrapped in
+// middleware.Instrument for metrics, access logs and panic recovery.
+// Pass the http.ServeMux itself so routes are labelled by pattern.
+func (a *App) Handle(h http.Handler, opts ...middleware.InstrumentOption) {
+	a.handler = middleware.Instrument(a.Metrics, a.Logger, opts...)(h)
+}
+
+// Go registers a background worker started by Run. Its context is
+// cancelled on shutdown; a worker returning an error stops the app.
+func (a *App) Go(name string, fn func(ctx context.Context) error) {
+	a.workers = append(a.workers, worker{name: name, fn: fn})
+}
+
+// OnShutdown registers fn to run after workers stopped and before
+// Redis and the database are closed, e.g. to flush buffers.
+func (a *App) OnShutdown(name string, fn func(ctx context.Context) error) {
+	a.hooks = append(a.hooks, hook{name: name, fn: fn})
+}
+
+// Run serves until ctx is done, SIGINT/SIGTERM arrives or a component
+// fails, then shuts down within HTTP_SHUTDOWN_TIMEOUT. When New loaded
+// the configuration from a file, the file is watched for changes.
+func (a *App) Run(ctx context.Context) error {
+	// A Logger replaced after New may have fixed levels
+	levels, levelsErr := a.Logger.Levels()
+	if a.Config.Log.AdminAddr != "" && levelsErr != nil {
+		return fmt.Errorf("app: log admin: %w", levelsErr)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if a.watchConfig {
+		a.Go("config watch", func(ctx context.Context) error {
+			if err := config.Watch(ctx, configWatchInterval); !errors.Is(err, config.ErrNoConfigFile) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	failed := make(chan error, len(a.workers)+3)
+
+	if a.handler != nil {
+		a.server = a.newServer(a.Config.HTTP.Addr, a.handler)
+		go a.listen(a.server, "http", failed)
+	}
+
+	if a.Config.Metrics.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle(a.Config.Metrics.Path, promhttp.HandlerFor(a.Registry, promhttp.HandlerOpts{}))
+		if levelsErr == nil {
+			mux.Handle("/log/level", levels.ReadOnly())
+		}
+		a.metricsServer = a.newServer(a.Config.Metrics.Addr, mux)
+		go a.listen(a.metricsServer, "metrics", failed)
+	}
+
+	if a.Config.Log.AdminAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/log/level", levels)
+		a.adminServer = a.newServer(a.Config.Log.AdminAddr, mux)
+		go a.listen(a.adminServer, "log admin", failed)
+	}
+
+	workerCtx, cancel := context.WithCancel(context.Background())
+	a.cancelWorkers = cancel
+	for _, w := range a.workers {
+		a.workersDone.Add(1)
+		go func(w worker) {
+			defer a.workersDone.Done()
+			if err := w.fn(workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+				failed <- fmt.Errorf("worker %s: %w", w.name, err)
+			}
+		}(w)
+	}
+
+	a.Logger.Infow("service started", "addr", a.Config.HTTP.Addr, "workers", len(a.workers))
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		a.Logger.Info("shutdown requested")
+	case runErr = <-failed:
+		a.Logger.Errorw("component failed, shutting down", "error", runErr)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), a.Config.HTTP.ShutdownTimeout)
+	defer cancelShutdown()
+
+	return errors.Join(runErr, a.Shutdown(shutdownCtx))
+}
+
+func (a *App) newServer(addr string, h http.Handler) *http.Server {
+	c := a.Config.HTTP
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+func (a *App) listen(srv *http.Server, name string, failed chan<- error) {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		failed <- fmt.Errorf("%s server: %w", name, err)
+	}
+}
+
+// Shutdown stops the app in order: drain HTTP, stop workers, run
+// OnShutdown hooks, close Redis, close the database. It runs once;
+// later calls return the first result.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		var errs []error
+		step := func(name string, err error) {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+
+		if a.server != nil {
+			step("http", a.server.Shutdown(ctx))
+		}
+		if a.metricsServer != nil {
+			step("metrics", a.metricsServer.Shutdown(ctx))
+		}
+		if a.adminServer != nil {
+			step("log admin", a.adminServer.Shutdown(ctx))
+		}
+
+		if a.cancelWorkers != nil {
+			a.cancelWorkers()
+		}
+		step("workers", wait(ctx, &a.workersDone))
+
+		for _, h := range a.hooks {
+			step(h.name, h.fn(ctx))
+		}
+
+		errs = append(errs, a.close())
+		a.shutdownErr = errors.Join(errs...)
+		if a.shutdownErr != nil {
+			a.Logger.Errorw("shutdown finished with errors", "error", a.shutdownErr)
+		} else {
+			a.Logger.Info("shutdown complete")
+		}
+	})
+	return a.shutdownErr
+}
+
+// close releases Redis, the database, the config subscription and
+// flushes the logger
+func (a *App) close() error {
+	var errs []error
+	if a.unsubscribe != nil {
+		a.unsubscribe()
+	}
+	if a.Redis != nil {
+		if err := a.Redis.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("redis: %w", err))
+		}
+	}
+	if a.DB != nil {
+		if err := database.Close(a.DB); err != nil {
+			errs = append(errs, fmt.Errorf("database: %w", err))
+		}
+	}
+	_ = a.Logger.Sync()
+	if a.telegram != nil {
+		if err := a.telegram.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("telegram log: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wait blocks until wg is done or ctx expires
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("still running: %w", ctx.Err())
+	}
+}
@@ -1,64 +1,342 @@
 package config
 
 import (
+	"errors"
 	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
+	Service  ServiceConfig
 	Database DbConfig
 	Redis    RedisConfig
+	Bot      BotConfig
+	JWT      JWTConfig
+	Log      LogConfig
+	Metrics  MetricsConfig
+	HTTP     HTTPConfig
+}
+
+// ServiceConfig identifies the running service instance.
+// InstanceID defaults to the hostname (the pod name on Kubernetes).
+type ServiceConfig struct {
+	Name        string `env:"SERVICE_NAME"`
+	InstanceID  string `env:"SERVICE_INSTANCE_ID"`
+	Region      string `env:"SERVICE_REGION" envDefault:"default"`
+	Version     string `env:"SERVICE_VERSION" envDefault:"dev"`
+	Environment string `env:"APP_ENV" envDefault:"development"`
 }
 
 type DbConfig struct {
 	User            string `env:"POSTGRES_USER"`
-	Password        string `env:"POSTGRES_PASSWORD"`
+	Password        string `env:"POSTGRES_PASSWORD" secret:"true"`
 	DBName          string `env:"POSTGRES_DB"`
-	Port            int64  `env:"POSTGRES_PORT"`
+	Port            int64  `env:"POSTGRES_PORT" envDefault:"5432"`
 	Host            string `env:"POSTGRES_HOST"`
-	MaxIdleConns    int    `env:"POSTGRES_MAX_IDLE_CONNS" envDefault:"10"`
-	MaxOpenConns    int    `env:"POSTGRES_MAX_OPEN_CONNS" envDefault:"100"`
-	ConnMaxLifetime int64  `env:"POSTGRES_CONN_MAX_LIFETIME" envDefault:"3600"`
+	MaxIdleConns    int    `env:"POSTGRES_MAX_IDLE_CONNS" envDefault:"10" reload:"true"`
+	MaxOpenConns    int    `env:"POSTGRES_MAX_OPEN_CONNS" envDefault:"100" reload:"true"`
+	ConnMaxLifetime int64  `env:"POSTGRES_CONN_MAX_LIFETIME" envDefault:"3600" reload:"true"`
 	LogLevel        string `env:"POSTGRES_LOG" envDefault:"info"`
+
+	// Query logging: slower statements are logged as warnings; others are
+	// sampled per statement shape, the first SampleInitial each second
+	// and then every SampleThereafter-th. 0 disables sampling.
+	SlowThreshold       time.Duration `env:"POSTGRES_SLOW_THRESHOLD" envDefault:"200ms"`
+	LogSampleInitial    int           `env:"POSTGRES_LOG_SAMPLE_INITIAL" envDefault:"10"`
+	LogSampleThereafter int           `env:"POSTGRES_LOG_SAMPLE_THEREAFTER" envDefault:"100"`
+
+	// TLS, see https://www.postgresql.org/docs/current/libpq-ssl.html
+	SSLMode     string `env:"POSTGRES_SSLMODE" envDefault:"disable"`
+	SSLRootCert string `env:"POSTGRES_SSLROOTCERT"`
+	SSLCert     string `env:"POSTGRES_SSLCERT"`
+	SSLKey      string `env:"POSTGRES_SSLKEY"`
+
+	// ApplicationName defaults to SERVICE_NAME
+	ApplicationName  string        `env:"POSTGRES_APPLICATION_NAME"`
+	ConnectTimeout   time.Duration `env:"POSTGRES_CONNECT_TIMEOUT" envDefault:"5s"`
+	StatementTimeout time.Duration `env:"POSTGRES_STATEMENT_TIMEOUT"`
+	SearchPath       string        `env:"POSTGRES_SEARCH_PATH"`
+	TimeZone         string        `env:"POSTGRES_TIMEZONE" envDefault:"UTC"`
+
+	// ReplicaHosts are read replicas as host or host:port, comma separated.
+	// They share the primary's credentials and database name.
+	ReplicaHosts []string `env:"POSTGRES_REPLICA_HOSTS"`
 }
 
+// RedisConfig selects the deployment by the fields set: REDIS_CLUSTER_ADDRS
+// for a cluster, REDIS_SENTINEL_MASTER for a sentinel-managed failover
+// group, otherwise the single node REDIS_HOST:REDIS_PORT.
 type RedisConfig struct {
 	Host         string `env:"REDIS_HOST"`
-	Port         string `env:"REDIS_PORT"`
-	Password     string `env:"REDIS_PASSWORD"`
+	Port         string `env:"REDIS_PORT" envDefault:"6379"`
+	Username     string `env:"REDIS_USERNAME"`
+	Password     string `env:"REDIS_PASSWORD" secret:"true"`
 	DB           int    `env:"REDIS_DB"`
 	PoolSize     int    `env:"REDIS_POOL_SIZE"`
 	MinIdleConns int    `env:"REDIS_MAX_IDLE_CONNS"`
+
+	SentinelMaster   string   `env:"REDIS_SENTINEL_MASTER"`
+	SentinelAddrs    []string `env:"REDIS_SENTINEL_ADDRS"`
+	SentinelPassword string   `env:"REDIS_SENTINEL_PASSWORD" secret:"true"`
+	ClusterAddrs     []string `env:"REDIS_CLUSTER_ADDRS"`
+
+	TLSEnabled            bool   `env:"REDIS_TLS"`
+	TLSCACert             string `env:"REDIS_TLS_CA_CERT"`
+	TLSCert               string `env:"REDIS_TLS_CERT"`
+	TLSKey                string `env:"REDIS_TLS_KEY"`
+	TLSServerName         string `env:"REDIS_TLS_SERVER_NAME"`
+	TLSInsecureSkipVerify bool   `env:"REDIS_TLS_INSECURE_SKIP_VERIFY"`
+
+	DialTimeout     time.Duration `env:"REDIS_DIAL_TIMEOUT" envDefault:"5s"`
+	ReadTimeout     time.Duration `env:"REDIS_READ_TIMEOUT" envDefault:"3s"`
+	WriteTimeout    time.Duration `env:"REDIS_WRITE_TIMEOUT" envDefault:"3s"`
+	MaxRetries      int           `env:"REDIS_MAX_RETRIES" envDefault:"3"`
+	MinRetryBackoff time.Duration `env:"REDIS_MIN_RETRY_BACKOFF" envDefault:"8ms"`
+	MaxRetryBackoff time.Duration `env:"REDIS_MAX_RETRY_BACKOFF" envDefault:"512ms"`
+}
+
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// Mode reports which Redis deployment the configuration describes
+func (c RedisConfig) Mode() string {
+	switch {
+	case len(c.ClusterAddrs) > 0:
+		return RedisModeCluster
+	case c.SentinelMaster != "":
+		return RedisModeSentinel
+	default:
+		return RedisModeSingle
+	}
 }
 
 type BotConfig struct {
-	Token           string `env:"TELEGRAM_BOT_TOKEN"`
+	Token           string `env:"TELEGRAM_BOT_TOKEN" secret:"true"`
 	Admin           int64  `env:"TELEGRAM_ADMIN_USER_ID"`
 	ChannelLogPanel int64  `env:"TELEGRAM_LOG_PANEL_VPN"`
+	// APIURL is the Bot API base URL, e.g. a local stub in tests
+	APIURL string `env:"TELEGRAM_API_URL" envDefault:"https://api.telegram.org"`
+
+	// Error logs forwarded to ChannelLogPanel are batched per
+	// LogFlushInterval, identical ones dropped within LogDedupWindow and
+	// at most LogRateLimit messages sent per minute
+	LogFlushInterval time.Duration `env:"TELEGRAM_LOG_FLUSH_INTERVAL" envDefault:"5s"`
+	LogDedupWindow   time.Duration `env:"TELEGRAM_LOG_DEDUP_WINDOW" envDefault:"5m"`
+	LogRateLimit     int           `env:"TELEGRAM_LOG_RATE_LIMIT" envDefault:"20"`
+}
+
+// JWTConfig holds the signing key and token lifetimes. Set Secret for
+// HS256 or PrivateKey (PEM, Ed25519 or RSA) for asymmetric signing.
+type JWTConfig struct {
+	Secret     string        `env:"JWT_SECRET" secret:"true"`
+	PrivateKey string        `env:"JWT_PRIVATE_KEY" secret:"true"`
+	KeyID      string        `env:"JWT_KEY_ID" envDefault:"default"`
+	Issuer     string        `env:"JWT_ISSUER" envDefault:"auth"`
+	Audience   []string      `env:"JWT_AUDIENCE" envSeparator:","`
+	AccessTTL  time.Duration `env:"JWT_ACCESS_TTL" envDefault:"15m"`
+	RefreshTTL time.Duration `env:"JWT_REFRESH_TTL" envDefault:"720h"`
+	ServiceTTL time.Duration `env:"JWT_SERVICE_TTL" envDefault:"1m"`
+	Leeway     time.Duration `env:"JWT_LEEWAY" envDefault:"30s"`
+
+	// Service-to-service tokens use keys of their own: ServicePrivateKey
+	// (PEM) signs the tokens of this service, ServicePublicKeys holds the
+	// base64 Ed25519 public key of every caller by service name
+	ServicePrivateKey string            `env:"JWT_SERVICE_PRIVATE_KEY" secret:"true"`
+	ServicePublicKeys map[string]string `env:"JWT_SERVICE_PUBLIC_KEYS"`
+}
+
+// LogConfig selects the zap level. Encoding is "json" or "console";
+// empty picks json in production and console elsewhere.
+type LogConfig struct {
+	Level    string `env:"LOG_LEVEL" envDefault:"info" reload:"true"`
+	Encoding string `env:"LOG_ENCODING"`
+	// Modules overrides the level per module, e.g. gorm:warn,tonproof:debug
+	Modules map[string]string `env:"LOG_MODULES" reload:"true"`
+
+	// Sampling keeps the first SamplingInitial entries with the same
+	// level and message per SamplingTick, then every SamplingThereafter-th.
+	// 0 disables sampling.
+	SamplingInitial    int           `env:"LOG_SAMPLING_INITIAL"`
+	SamplingThereafter int           `env:"LOG_SAMPLING_THEREAFTER"`
+	SamplingTick       time.Duration `env:"LOG_SAMPLING_TICK" envDefault:"1s"`
+
+	// AdminAddr serves PUT /log/level to change levels at runtime; off
+	// when empty. It is unauthenticated, bind it to loopback or an
+	// internal network.
+	AdminAddr string `env:"LOG_ADMIN_ADDR"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `env:"METRICS_ENABLED" envDefault:"true"`
+	Addr    string `env:"METRICS_ADDR" envDefault:":9090"`
+	Path    string `env:"METRICS_PATH" envDefault:"/metrics"`
+	// Namespace prefixes the names of the shared metrics, e.g. "wallet"
+	Namespace string `env:"METRICS_NAMESPACE"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `env:"HTTP_ADDR" envDefault:":8080"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" envDefault:"15s"`
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" envDefault:"5s"`
+	WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" envDefault:"15s"`
+	IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" envDefault:"60s"`
+	ShutdownTimeout   time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT" envDefault:"15s"`
+	MaxHeaderBytes    int           `env:"HTTP_MAX_HEADER_BYTES" envDefault:"1048576"`
+}
+
+// IsProduction reports whether APP_ENV is "production"
+func (c *ServiceConfig) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+var (
+	conf   atomic.Pointer[Config]
+	loadMu sync.Mutex
+)
+
+type loadOptions struct {
+	envFiles      []string
+	environment   map[string]string
+	secretSources []SecretSource
+	profile       string
+	file          string
+}
+
+type Option func(*loadOptions)
+
+// WithEnvFiles reads the given dotenv files instead of ".env".
+// Missing files are ignored; real environment variables win.
+func WithEnvFiles(files ...string) Option {
+	return func(o *loadOptions) { o.envFiles = files }
 }
 
-var conf *Config
+// WithEnvironment replaces the process environment, e.g. in tests
+func WithEnvironment(environment map[string]string) Option {
+	return func(o *loadOptions) { o.environment = environment }
+}
 
+// GetConfig returns the configuration stored by the last successful
+// Load, loading it from the environment on first use. It returns nil
+// only if that first load fails; use Load to see why.
 func GetConfig() *Config {
+	if cfg := conf.Load(); cfg != nil {
+		return cfg
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
 
-	return conf
+	if cfg := conf.Load(); cfg != nil {
+		return cfg
+	}
+	cfg, file, err := load(nil)
+	if err != nil {
+		return nil
+	}
+	conf.Store(cfg)
+	lastOpts, lastFile = nil, file
+	return cfg
 }
 
+// Load parses and validates the configuration and makes it the one
+// returned by GetConfig. Every parse and validation problem is
+// reported in the returned error.
+func Load(opts ...Option) (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	cfg, file, err := load(opts)
+	if err != nil {
+		return nil, err
+	}
+	conf.Store(cfg)
+	lastOpts, lastFile = opts, file
+	return cfg, nil
+}
+
+// LoadConfig loads the configuration and exits the process on error.
+//
+// Deprecated: use Load and handle the error.
 func LoadConfig() *Config {
-	_ = godotenv.Load()
+	cfg, err := Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	return cfg
+}
+
+func load(opts []Option) (*Config, string, error) {
+	o := &loadOptions{envFiles: []string{".env"}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	environment, file, err := o.layer(o.resolveEnvironment())
+	if err != nil {
+		return nil, file, Errors{{Env: "CONFIG_FILE", Message: err.Error()}}
+	}
+	problems := o.resolveSecrets(environment)
 
 	cfg := &Config{}
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: environment}); err != nil {
+		problems = append(problems, parseErrors(err)...)
+	}
 
-	// Parse each section into nested struct
-	if err := env.Parse(&cfg.Database); err != nil {
-		log.Fatalf("Failed to parse Postgres config: %v", err)
+	if cfg.Service.InstanceID == "" {
+		cfg.Service.InstanceID, _ = os.Hostname()
 	}
-	if err := env.Parse(&cfg.Redis); err != nil {
-		log.Fatalf("Failed to parse Redis config: %v", err)
+	if cfg.Database.ApplicationName == "" {
+		cfg.Database.ApplicationName = cfg.Service.Name
+	}
+
+	// Validate even after parse errors so every problem is reported at once
+	var verrs Errors
+	if errors.As(cfg.Validate(), &verrs) {
+		problems = append(problems, verrs...)
 	}
 
-	conf = cfg
-	return conf
+	if len(problems) > 0 {
+		return nil, file, problems
+	}
+	return cfg, file, nil
+}
+
+// resolveEnvironment merges dotenv files under the process environment
+// into a fresh map, so concurrent loads cannot interfere.
+func (o *loadOptions) resolveEnvironment() map[string]string {
+	merged := map[string]string{}
+	if o.environment != nil {
+		for k, v := range o.environment {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	for _, file := range o.envFiles {
+		values, err := godotenv.Read(file)
+		if err != nil {
+			continue
+		}
+		for k, v := range values {
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			merged[k] = v
+		}
+	}
+	return merged
 }
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadAggregatesErrors(t *testing.T) {
+	environment := testEnvironment(
+		"POSTGRES_PORT", "not-a-port",
+		"REDIS_DB", "16",
+		"LOG_LEVEL", "loud",
+		"HTTP_ADDR", "8080",
+		"JWT_SECRET", "short",
+	)
+	delete(environment, "POSTGRES_HOST")
+	delete(environment, "POSTGRES_USER")
+
+	cfg, err := Load(WithEnvironment(environment))
+	if cfg != nil {
+		t.Fatal("Load returned a config with errors")
+	}
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %T, want Errors", err)
+	}
+
+	got := map[string]bool{}
+	for _, fe := range errs {
+		got[fe.Env] = true
+	}
+	for _, name := range []string{"POSTGRES_HOST", "POSTGRES_USER", "REDIS_DB", "LOG_LEVEL", "HTTP_ADDR", "JWT_SECRET"} {
+		if !got[name] {
+			t.Errorf("no error for %s in %v", name, err)
+		}
+	}
+	// Parse errors are reported with the validation errors
+	if !strings.Contains(err.Error(), "POSTGRES_PORT") {
+		t.Errorf("no error for POSTGRES_PORT in %v", err)
+	}
+	if prefix := fmt.Sprintf("invalid config (%d problems): ", len(errs)); !strings.HasPrefix(err.Error(), prefix) {
+		t.Errorf("error = %q", err)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	resetConfig(t)
+	for k, v := range testEnvironment("POSTGRES_HOST", "from-process", "CONFIG_FILE", "") {
+		t.Setenv(k, v)
+	}
+
+	first := GetConfig()
+	if first == nil || first.Database.Host != "from-process" {
+		t.Fatalf("GetConfig before Load = %+v, want the process environment", first)
+	}
+	if GetConfig() != first {
+		t.Error("GetConfig loaded the environment again")
+	}
+
+	loaded, err := Load(WithEnvironment(testEnvironment("POSTGRES_HOST", "loaded")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetConfig() != loaded {
+		t.Error("GetConfig does not return the config of the last Load")
+	}
+
+	if _, err := Load(WithEnvironment(testEnvironment("LOG_LEVEL", "loud"))); err == nil {
+		t.Fatal("invalid config loaded")
+	}
+	if GetConfig() != loaded {
+		t.Error("a failed Load replaced the config")
+	}
+}
+
+func TestGetConfigInvalidEnvironment(t *testing.T) {
+	resetConfig(t)
+	t.Setenv("POSTGRES_HOST", "")
+	t.Setenv("CONFIG_FILE", "")
+
+	if cfg := GetConfig(); cfg != nil {
+		t.Fatalf("GetConfig = %+v, want nil", cfg)
+	}
+}
+
+func TestConcurrentLoadAndGetConfig(t *testing.T) {
+	resetConfig(t)
+	if _, err := Load(WithEnvironment(testEnvironment("POSTGRES_HOST", "host-0"))); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				host := fmt.Sprintf("host-%d", (i*20+j)%5)
+				if _, err := Load(WithEnvironment(testEnvironment("POSTGRES_HOST", host))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				cfg := GetConfig()
+				if cfg == nil || !strings.HasPrefix(cfg.Database.Host, "host-") || cfg.Redis.Host != "localhost" {
+					t.Errorf("GetConfig = %+v", cfg)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Configuration is layered, later layers winning:
+//  1. envDefault tags
+//  2. the profile selected by APP_ENV (or WithProfile)
+//  3. the YAML/JSON file given by WithFile or CONFIG_FILE
+//  4. .env files and the process environment
+
+// profileDefaults override envDefault tags per environment profile
+var profileDefaults = map[string]map[string]string{
+	"development": {
+		"LOG_LEVEL":    "debug",
+		"LOG_ENCODING": "console",
+	},
+	"test": {
+		"LOG_LEVEL":       "warn",
+		"LOG_ENCODING":    "console",
+		"POSTGRES_LOG":    "silent",
+		"METRICS_ENABLED": "false",
+	},
+	"staging": {
+		"LOG_LEVEL":    "info",
+		"LOG_ENCODING": "json",
+	},
+	"production": {
+		"LOG_LEVEL":               "info",
+		"LOG_ENCODING":            "json",
+		"LOG_SAMPLING_INITIAL":    "100",
+		"LOG_SAMPLING_THEREAFTER": "100",
+		"POSTGRES_LOG":            "warn",
+		"POSTGRES_MAX_OPEN_CONNS": "50",
+	},
+}
+
+// WithProfile selects the environment profile instead of APP_ENV
+func WithProfile(profile string) Option {
+	return func(o *loadOptions) { o.profile = profile }
+}
+
+// WithFile reads a YAML or JSON file of variable names to values, e.g.
+//
+//	POSTGRES_HOST: db.internal
+//	LOG_LEVEL: warn
+//
+// Without it the file named by CONFIG_FILE is used, if any.
+func WithFile(path string) Option {
+	return func(o *loadOptions) { o.file = path }
+}
+
+// fieldNames holds the variable of every Config field
+var fieldNames = func() map[string]bool {
+	names := map[string]bool{}
+	for _, f := range configFields(reflect.TypeOf(Config{})) {
+		names[f.env] = true
+	}
+	return names
+}()
+
+// layer builds the environment map seen by the parser from all layers
+func (o *loadOptions) layer(environment map[string]string) (map[string]string, string, error) {
+	file := o.file
+	if file == "" {
+		file = environment["CONFIG_FILE"]
+	}
+
+	var fileValues map[string]string
+	if file != "" {
+		values, err := readConfigFile(file)
+		if err != nil {
+			return nil, file, err
+		}
+		fileValues = values
+	}
+
+	profile := o.profile
+	if profile == "" {
+		profile = environment["APP_ENV"]
+	}
+	if profile == "" {
+		profile = fileValues["APP_ENV"]
+	}
+	if profile == "" {
+		profile = "development"
+	}
+
+	merged := map[string]string{}
+	for _, layer := range []map[string]string{profileDefaults[profile], fileValues, environment} {
+		// NAME_FILE replaces NAME of the layers below and the other way
+		// round; within one layer NAME wins, see resolveSecrets
+		for k := range layer {
+			if name, ok := strings.CutSuffix(k, "_FILE"); ok && fieldNames[name] {
+				delete(merged, name)
+			} else if fieldNames[k] {
+				delete(merged, k+"_FILE")
+			}
+		}
+		for k, v := range layer {
+			merged[k] = v
+		}
+	}
+	merged["APP_ENV"] = profile
+
+	return merged, file, nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file: unsupported format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		s, err := scalarString(v)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, k, err)
+		}
+		values[k] = s
+	}
+	return values, nil
+}
+
+// scalarString renders file values the way they would be written in
+// the environment; lists become comma separated.
+func scalarString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool, int, int64:
+		return fmt.Sprint(t), nil
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, item := range t {
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("nested values are not supported, use variable names as keys")
+	}
+}
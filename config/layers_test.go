@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEnvironment is the smallest valid environment plus overrides
+// given as name, value pairs
+func testEnvironment(kv ...string) map[string]string {
+	environment := map[string]string{
+		"POSTGRES_HOST": "localhost",
+		"POSTGRES_USER": "wallet",
+		"POSTGRES_DB":   "wallet",
+		"REDIS_HOST":    "localhost",
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		environment[kv[i]] = kv[i+1]
+	}
+	return environment
+}
+
+// writeFile writes content to name in a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayerPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", "LOG_LEVEL: warn\nPOSTGRES_MAX_OPEN_CONNS: 60\n")
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		level       string
+		maxOpen     int
+		environment string
+	}{
+		{"tag defaults", []Option{WithEnvironment(testEnvironment())}, "debug", 100, "development"},
+		{"profile over tags", []Option{WithEnvironment(testEnvironment("APP_ENV", "production"))}, "info", 50, "production"},
+		{"file over profile", []Option{
+			WithEnvironment(testEnvironment("APP_ENV", "production")), WithFile(file),
+		}, "warn", 60, "production"},
+		{"environment over file", []Option{
+			WithEnvironment(testEnvironment("APP_ENV", "production", "LOG_LEVEL", "error")), WithFile(file),
+		}, "error", 60, "production"},
+		{"CONFIG_FILE", []Option{WithEnvironment(testEnvironment("CONFIG_FILE", file))}, "warn", 60, "development"},
+		{"WithProfile over APP_ENV", []Option{
+			WithEnvironment(testEnvironment("APP_ENV", "staging")), WithProfile("production"),
+		}, "info", 50, "production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := load(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Log.Level != tt.level || cfg.Database.MaxOpenConns != tt.maxOpen || cfg.Service.Environment != tt.environment {
+				t.Errorf("LOG_LEVEL = %s, POSTGRES_MAX_OPEN_CONNS = %d, APP_ENV = %s; want %s, %d, %s",
+					cfg.Log.Level, cfg.Database.MaxOpenConns, cfg.Service.Environment, tt.level, tt.maxOpen, tt.environment)
+			}
+		})
+	}
+}
+
+func TestProfileFromFile(t *testing.T) {
+	file := writeFile(t, "config.json", `{"APP_ENV": "production"}`)
+	cfg, _, err := load([]Option{WithEnvironment(testEnvironment()), WithFile(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Service.Environment != "production" || cfg.Log.Encoding != "json" {
+		t.Errorf("APP_ENV = %s, LOG_ENCODING = %s", cfg.Service.Environment, cfg.Log.Encoding)
+	}
+}
+
+func TestFileVariableOverridesLowerLayers(t *testing.T) {
+	secret := writeFile(t, "db_password", "from-secret-file\n")
+	file := writeFile(t, "config.yaml", "POSTGRES_PASSWORD: from-config-file\n")
+	fileRef := writeFile(t, "config.yaml", "POSTGRES_PASSWORD_FILE: "+secret+"\n")
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"environment _FILE over file value", []Option{
+			WithEnvironment(testEnvironment("POSTGRES_PASSWORD_FILE", secret)), WithFile(file),
+		}, "from-secret-file"},
+		{"environment value over file _FILE", []Option{
+			WithEnvironment(testEnvironment("POSTGRES_PASSWORD", "from-env")), WithFile(fileRef),
+		}, "from-env"},
+		{"value over _FILE in one layer", []Option{
+			WithEnvironment(testEnvironment("POSTGRES_PASSWORD", "from-env", "POSTGRES_PASSWORD_FILE", secret)),
+		}, "from-env"},
+		{"_FILE from the config file", []Option{WithEnvironment(testEnvironment()), WithFile(fileRef)}, "from-secret-file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := load(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Database.Password != tt.want {
+				t.Errorf("POSTGRES_PASSWORD = %q, want %q", cfg.Database.Password, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	for name, path := range map[string]string{
+		"missing":     filepath.Join(t.TempDir(), "missing.yaml"),
+		"unsupported": writeFile(t, "config.toml", "LOG_LEVEL = 'warn'"),
+		"nested":      writeFile(t, "config.yaml", "postgres:\n  host: db\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := load([]Option{WithEnvironment(testEnvironment()), WithFile(path)})
+			errs, ok := err.(Errors)
+			if !ok || len(errs) != 1 || errs[0].Env != "CONFIG_FILE" {
+				t.Fatalf("got %v, want one CONFIG_FILE error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoConfigFile is returned by Watch when the configuration was not
+// loaded from a file
+var ErrNoConfigFile = errors.New("config: no config file to watch")
+
+// Subscriber is notified after a reload changed the configuration
+type Subscriber func(old, current *Config)
+
+var (
+	subsMu  sync.Mutex
+	subs    = map[int]Subscriber{}
+	nextSub int
+
+	// lastOpts and lastFile remember how the current config was loaded
+	lastOpts []Option
+	lastFile string
+)
+
+// Subscribe registers fn for configuration changes and returns a
+// function that removes it.
+func Subscribe(fn Subscriber) (unsubscribe func()) {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+
+	id := nextSub
+	nextSub++
+	subs[id] = fn
+
+	return func() {
+		subsMu.Lock()
+		defer subsMu.Unlock()
+		delete(subs, id)
+	}
+}
+
+// Reload loads the configuration again with the options of the last
+// Load. Only fields tagged reload:"true" (log levels, pool sizes) are
+// applied; other changes need a restart and are logged.
+// An invalid new configuration is rejected and the current one kept.
+func Reload() (*Config, error) {
+	loadMu.Lock()
+
+	old := conf.Load()
+	if old == nil {
+		loadMu.Unlock()
+		return nil, errors.New("config: reload before load")
+	}
+
+	next, _, err := load(lastOpts)
+	if err != nil {
+		loadMu.Unlock()
+		return old, err
+	}
+
+	merged, applied, ignored := mergeReloadable(old, next)
+	if len(ignored) > 0 {
+		log.Printf("config: restart required to apply %s", strings.Join(ignored, ", "))
+	}
+	if len(applied) == 0 {
+		loadMu.Unlock()
+		return old, nil
+	}
+
+	conf.Store(merged)
+	loadMu.Unlock()
+
+	subsMu.Lock()
+	fns := make([]Subscriber, 0, len(subs))
+	for _, fn := range subs {
+		fns = append(fns, fn)
+	}
+	subsMu.Unlock()
+
+	for _, fn := range fns {
+		fn(old, merged)
+	}
+	return merged, nil
+}
+
+// Watch polls the config file every interval and reloads it when its
+// modification time changes, until ctx is done.
+func Watch(ctx context.Context, interval time.Duration) error {
+	loadMu.Lock()
+	file := lastFile
+	loadMu.Unlock()
+
+	if file == "" {
+		return ErrNoConfigFile
+	}
+
+	modTime := func() time.Time {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	last := modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			current := modTime()
+			if current.IsZero() || current.Equal(last) {
+				continue
+			}
+			last = current
+			if _, err := Reload(); err != nil {
+				log.Printf("config: reload of %s rejected: %v", file, err)
+			}
+		}
+	}
+}
+
+// mergeReloadable returns a copy of old with the reloadable fields of
+// next, plus the variables applied and those that changed but were not.
+func mergeReloadable(old, next *Config) (*Config, []string, []string) {
+	merged := *old
+	var applied, ignored []string
+	walkReloadable(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem(), &applied, &ignored)
+	return &merged, applied, ignored
+}
+
+func walkReloadable(dst, src reflect.Value, applied, ignored *[]string) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Tag.Get("env") == "" {
+			walkReloadable(dst.Field(i), src.Field(i), applied, ignored)
+			continue
+		}
+
+		if reflect.DeepEqual(dst.Field(i).Interface(), src.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if f.Tag.Get("reload") == "true" {
+			dst.Field(i).Set(src.Field(i))
+			*applied = append(*applied, name)
+		} else {
+			*ignored = append(*ignored, name)
+		}
+	}
+}
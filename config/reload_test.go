@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// resetConfig forgets the loaded configuration after the test
+func resetConfig(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		loadMu.Lock()
+		defer loadMu.Unlock()
+		conf.Store(nil)
+		lastOpts, lastFile = nil, ""
+	})
+}
+
+func TestMergeReloadable(t *testing.T) {
+	old, _, err := load([]Option{WithEnvironment(testEnvironment())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _, err := load([]Option{WithEnvironment(testEnvironment(
+		"LOG_LEVEL", "warn",
+		"LOG_MODULES", "gorm:error",
+		"POSTGRES_MAX_OPEN_CONNS", "20",
+		"POSTGRES_HOST", "db.internal",
+		"HTTP_ADDR", ":9000",
+	))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, applied, ignored := mergeReloadable(old, next)
+	if merged.Log.Level != "warn" || merged.Log.Modules["gorm"] != "error" || merged.Database.MaxOpenConns != 20 {
+		t.Errorf("reloadable fields not applied: %+v, %+v", merged.Log, merged.Database)
+	}
+	if merged.Database.Host != "localhost" || merged.HTTP.Addr != ":8080" {
+		t.Errorf("non-reloadable fields applied: host %s, addr %s", merged.Database.Host, merged.HTTP.Addr)
+	}
+	if want := []string{"POSTGRES_MAX_OPEN_CONNS", "LOG_LEVEL", "LOG_MODULES"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if want := []string{"POSTGRES_HOST", "HTTP_ADDR"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+	if old.Log.Level != "debug" || old.Database.MaxOpenConns != 100 {
+		t.Error("mergeReloadable modified the current config")
+	}
+}
+
+func TestReloadAppliesOnlyReloadableFields(t *testing.T) {
+	resetConfig(t)
+	file := writeFile(t, "config.yaml", "LOG_LEVEL: info\nPOSTGRES_HOST: db-1\n")
+	environment := testEnvironment()
+	delete(environment, "POSTGRES_HOST")
+	if _, err := Load(WithEnvironment(environment), WithFile(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	var old, current *Config
+	unsubscribe := Subscribe(func(o, c *Config) { calls, old, current = calls+1, o, c })
+	defer unsubscribe()
+
+	if err := os.WriteFile(file, []byte("LOG_LEVEL: warn\nPOSTGRES_HOST: db-2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Log.Level != "warn" || cfg.Database.Host != "db-1" {
+		t.Errorf("LOG_LEVEL = %s, POSTGRES_HOST = %s; want warn, db-1", cfg.Log.Level, cfg.Database.Host)
+	}
+	if GetConfig() != cfg {
+		t.Error("GetConfig does not return the reloaded config")
+	}
+	if calls != 1 || old.Log.Level != "info" || current != cfg {
+		t.Errorf("subscriber called %d times with %v -> %v", calls, old, current)
+	}
+
+	// Only non-reloadable changes: nothing to apply, nobody notified
+	if err := os.WriteFile(file, []byte("LOG_LEVEL: warn\nPOSTGRES_HOST: db-3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := Reload(); err != nil || again != cfg || calls != 1 {
+		t.Errorf("reload without reloadable changes: %v, %d calls", err, calls)
+	}
+
+	// An invalid file keeps the current config
+	if err := os.WriteFile(file, []byte("LOG_LEVEL: loud\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if kept, err := Reload(); err == nil || kept != cfg || GetConfig() != cfg {
+		t.Errorf("invalid reload: %v", err)
+	}
+}
+
+func TestReloadBeforeLoad(t *testing.T) {
+	resetConfig(t)
+	loadMu.Lock()
+	conf.Store(nil)
+	loadMu.Unlock()
+
+	if _, err := Reload(); err == nil {
+		t.Fatal("Reload succeeded without a loaded config")
+	}
+	if err := Watch(t.Context(), time.Millisecond); err != ErrNoConfigFile {
+		t.Errorf("Watch = %v, want ErrNoConfigFile", err)
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const redactedValue = "******"
+
+// SecretSource resolves secrets that are not set in the environment,
+// e.g. from Vault or a cloud secret manager. Lookup returns ok=false
+// when the source does not hold the secret.
+type SecretSource interface {
+	Lookup(ctx context.Context, envName string) (value string, ok bool, err error)
+}
+
+type SecretSourceFunc func(ctx context.Context, envName string) (string, bool, error)
+
+func (f SecretSourceFunc) Lookup(ctx context.Context, envName string) (string, bool, error) {
+	return f(ctx, envName)
+}
+
+// WithSecretSource adds a source consulted, in order, for secret fields
+// left empty by the environment and *_FILE variables.
+func WithSecretSource(src SecretSource) Option {
+	return func(o *loadOptions) { o.secretSources = append(o.secretSources, src) }
+}
+
+// DirSource reads secrets from files named after the variable, as
+// mounted by Docker (/run/secrets) or Kubernetes secret volumes.
+// Both POSTGRES_PASSWORD and postgres_password are tried.
+func DirSource(dir string) SecretSource {
+	return SecretSourceFunc(func(_ context.Context, envName string) (string, bool, error) {
+		for _, name := range []string{envName, strings.ToLower(envName)} {
+			value, err := readSecretFile(filepath.Join(dir, name))
+			if err == nil {
+				return value, true, nil
+			}
+			if !os.IsNotExist(err) {
+				return "", false, err
+			}
+		}
+		return "", false, nil
+	})
+}
+
+type fieldInfo struct {
+	env    string
+	secret bool
+}
+
+// configFields lists the env variable of every field, marking those
+// tagged secret:"true"
+func configFields(t reflect.Type) []fieldInfo {
+	var out []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Tag.Get("env") == "" {
+			out = append(out, configFields(f.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if name != "" {
+			out = append(out, fieldInfo{env: name, secret: f.Tag.Get("secret") == "true"})
+		}
+	}
+	return out
+}
+
+// resolveSecrets fills variables from NAME_FILE, then secret sources.
+// A value set directly in the environment always wins.
+func (o *loadOptions) resolveSecrets(environment map[string]string) Errors {
+	var problems Errors
+
+	for _, f := range configFields(reflect.TypeOf(Config{})) {
+		if environment[f.env] != "" {
+			continue
+		}
+
+		if path := environment[f.env+"_FILE"]; path != "" {
+			value, err := readSecretFile(path)
+			if err != nil {
+				problems = append(problems, FieldError{Env: f.env + "_FILE", Message: err.Error()})
+				continue
+			}
+			environment[f.env] = value
+			continue
+		}
+
+		if !f.secret {
+			continue
+		}
+		for _, src := range o.secretSources {
+			value, ok, err := src.Lookup(context.Background(), f.env)
+			if err != nil {
+				problems = append(problems, FieldError{Env: f.env, Message: "secret source: " + err.Error()})
+				break
+			}
+			if ok {
+				environment[f.env] = value
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Redacted returns a copy with every secret field masked
+func (c Config) Redacted() Config {
+	v := reflect.ValueOf(&c).Elem()
+	redact(v)
+	return c
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Struct:
+			redact(f)
+		case t.Field(i).Tag.Get("secret") == "true" && !f.IsZero():
+			f.Set(masked(f))
+		}
+	}
+}
+
+// masked returns v with every secret value replaced: strings and
+// []byte by redactedValue, slice elements and map values one by one.
+// Map keys are kept. Other kinds are zeroed so nothing can leak.
+func masked(v reflect.Value) reflect.Value {
+	switch {
+	case v.Kind() == reflect.String:
+		return reflect.ValueOf(redactedValue).Convert(v.Type())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return reflect.ValueOf([]byte(redactedValue)).Convert(v.Type())
+	case v.Kind() == reflect.Slice:
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(masked(v.Index(i)))
+		}
+		return out
+	case v.Kind() == reflect.Map:
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), masked(iter.Value()))
+		}
+		return out
+	default:
+		return reflect.Zero(v.Type())
+	}
+}
+
+// MarshalJSON encodes the configuration with secrets masked
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(plain(c.Redacted()))
+}
+
+// String renders the effective configuration for startup logs
+func (c Config) String() string {
+	b, err := c.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(b)
+}
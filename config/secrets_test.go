@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	secret := writeFile(t, "jwt_secret", "0123456789abcdef0123456789abcdef\r\n")
+	cfg, _, err := load([]Option{WithEnvironment(testEnvironment("JWT_SECRET_FILE", secret))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWT.Secret != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("JWT_SECRET = %q, want the file without the line break", cfg.JWT.Secret)
+	}
+
+	// Not only secrets can come from files
+	host := writeFile(t, "host", "db.internal")
+	cfg, _, err = load([]Option{WithEnvironment(testEnvironment("POSTGRES_HOST_FILE", host, "POSTGRES_HOST", ""))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Host != "db.internal" {
+		t.Errorf("POSTGRES_HOST = %q", cfg.Database.Host)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, _, err = load([]Option{WithEnvironment(testEnvironment("POSTGRES_PASSWORD_FILE", missing))})
+	if !hasFieldError(err, "POSTGRES_PASSWORD_FILE") {
+		t.Errorf("missing file: got %v, want a POSTGRES_PASSWORD_FILE error", err)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"POSTGRES_PASSWORD": "db-secret\n",
+		"redis_password":    "redis-secret",
+		"POSTGRES_HOST":     "not-a-secret",
+		"JWT_SECRET":        "0123456789abcdef0123456789abcdef",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, _, err := load([]Option{
+		WithEnvironment(testEnvironment("JWT_SECRET", "fedcba9876543210fedcba9876543210")),
+		WithSecretSource(DirSource(dir)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Password != "db-secret" || cfg.Redis.Password != "redis-secret" {
+		t.Errorf("passwords = %q, %q", cfg.Database.Password, cfg.Redis.Password)
+	}
+	if cfg.Database.Host != "localhost" {
+		t.Errorf("non-secret POSTGRES_HOST read from the source: %q", cfg.Database.Host)
+	}
+	if cfg.JWT.Secret != "fedcba9876543210fedcba9876543210" {
+		t.Error("secret source overrode the environment")
+	}
+	if cfg.Bot.Token != "" {
+		t.Errorf("TELEGRAM_BOT_TOKEN = %q, want empty", cfg.Bot.Token)
+	}
+}
+
+func TestSecretSourceErrors(t *testing.T) {
+	failing := SecretSourceFunc(func(_ context.Context, envName string) (string, bool, error) {
+		if envName == "REDIS_PASSWORD" {
+			return "", false, errors.New("vault sealed")
+		}
+		return "", false, nil
+	})
+	_, _, err := load([]Option{WithEnvironment(testEnvironment()), WithSecretSource(failing)})
+	if !hasFieldError(err, "REDIS_PASSWORD") || !strings.Contains(err.Error(), "vault sealed") {
+		t.Errorf("got %v, want the source error for REDIS_PASSWORD", err)
+	}
+
+	// A directory where a secret file is expected is not "missing"
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "POSTGRES_PASSWORD"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = load([]Option{WithEnvironment(testEnvironment()), WithSecretSource(DirSource(dir))})
+	if !hasFieldError(err, "POSTGRES_PASSWORD") {
+		t.Errorf("got %v, want a POSTGRES_PASSWORD error", err)
+	}
+}
+
+func TestStringHidesSecrets(t *testing.T) {
+	secrets := []string{"db-secret", "redis-secret", "sentinel-secret", "12345:bot-secret", "0123456789abcdef0123456789abcdef", "service-key-pem"}
+	cfg, _, err := load([]Option{WithEnvironment(testEnvironment(
+		"POSTGRES_PASSWORD", secrets[0],
+		"REDIS_PASSWORD", secrets[1],
+		"REDIS_SENTINEL_PASSWORD", secrets[2],
+		"TELEGRAM_BOT_TOKEN", secrets[3],
+		"JWT_SECRET", secrets[4],
+		"JWT_SERVICE_PRIVATE_KEY", secrets[5],
+		"SERVICE_NAME", "auth",
+	))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []string{cfg.String(), fmt.Sprint(cfg), fmt.Sprintf("%+v", *cfg), string(doc)} {
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) {
+				t.Errorf("%q leaks in %s", secret, out)
+			}
+		}
+		if !strings.Contains(out, redactedValue) || !strings.Contains(out, "localhost") {
+			t.Errorf("output is not the redacted config: %s", out)
+		}
+	}
+	if cfg.Database.Password != secrets[0] {
+		t.Error("redacting modified the config")
+	}
+}
+
+func TestRedactNonStringSecrets(t *testing.T) {
+	type section struct {
+		Name   string            `env:"NAME"`
+		Raw    []byte            `env:"RAW" secret:"true"`
+		List   []string          `env:"LIST" secret:"true"`
+		Keys   map[string]string `env:"KEYS" secret:"true"`
+		Number int               `env:"NUMBER" secret:"true"`
+		Empty  []string          `env:"EMPTY" secret:"true"`
+	}
+	original := section{
+		Name:   "visible",
+		Raw:    []byte("raw-secret"),
+		List:   []string{"first-secret", "second-secret"},
+		Keys:   map[string]string{"game": "game-secret"},
+		Number: 1234,
+	}
+
+	v := original
+	redact(reflect.ValueOf(&v).Elem())
+	want := section{
+		Name: "visible",
+		Raw:  []byte(redactedValue),
+		List: []string{redactedValue, redactedValue},
+		Keys: map[string]string{"game": redactedValue},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("redacted = %+v, want %+v", v, want)
+	}
+	if string(original.Raw) != "raw-secret" || original.List[0] != "first-secret" || original.Keys["game"] != "game-secret" {
+		t.Errorf("redact modified the shared values: %+v", original)
+	}
+}
+
+func hasFieldError(err error, envName string) bool {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, fe := range errs {
+		if fe.Env == envName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v10"
+)
+
+// FieldError is one invalid setting, named by its environment variable
+type FieldError struct {
+	Env     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Env == "" {
+		return e.Message
+	}
+	return e.Env + ": " + e.Message
+}
+
+// Errors aggregates every problem found while loading the configuration
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("invalid config (%d problems): %s", len(e), strings.Join(msgs, "; "))
+}
+
+type validator struct {
+	errs Errors
+}
+
+func (v *validator) add(envName, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Env: envName, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(envName, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(envName, "is required")
+	}
+}
+
+func (v *validator) port(envName string, port int64) {
+	if port < 1 || port > 65535 {
+		v.add(envName, "must be a port between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) min(envName string, value, min int64) {
+	if value < min {
+		v.add(envName, "must be at least %d, got %d", min, value)
+	}
+}
+
+func (v *validator) positive(envName string, d time.Duration) {
+	if d <= 0 {
+		v.add(envName, "must be a positive duration, got %s", d)
+	}
+}
+
+func (v *validator) hostPort(envName, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		v.add(envName, "must be host:port, got %q", addr)
+		return
+	}
+	p, err := strconv.ParseInt(port, 10, 64)
+	if err != nil {
+		v.add(envName, "must have a numeric port, got %q", port)
+		return
+	}
+	v.port(envName, p)
+}
+
+func (v *validator) oneOf(envName, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(envName, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// file checks that an optional path points to a readable file
+func (v *validator) file(envName, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.add(envName, "%v", err)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Validate checks required fields, ranges and formats of every section
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.Service.validate(v)
+	c.Database.validate(v)
+	c.Redis.validate(v)
+	c.Bot.validate(v)
+	c.JWT.validate(v)
+	c.Log.validate(v)
+	c.Metrics.validate(v)
+	c.HTTP.validate(v)
+	return v.err()
+}
+
+// SERVICE_NAME is not required here: services still on LoadConfig may
+// not set it. app.New and JWT_SERVICE_PRIVATE_KEY require it instead.
+func (c *ServiceConfig) validate(v *validator) {
+	v.oneOf("APP_ENV", c.Environment, "development", "staging", "production", "test")
+}
+
+func (c *DbConfig) Validate() error {
+	v := &validator{}
+	c.validate(v)
+	return v.err()
+}
+
+func (c *DbConfig) validate(v *validator) {
+	v.required("POSTGRES_HOST", c.Host)
+	v.required("POSTGRES_USER", c.User)
+	v.required("POSTGRES_DB", c.DBName)
+	v.port("POSTGRES_PORT", c.Port)
+	v.min("POSTGRES_MAX_IDLE_CONNS", int64(c.MaxIdleConns), 0)
+	v.min("POSTGRES_MAX_OPEN_CONNS", int64(c.MaxOpenConns), 1)
+	if c.MaxIdleConns > c.MaxOpenConns && c.MaxOpenConns > 0 {
+		v.add("POSTGRES_MAX_IDLE_CONNS", "must not exceed POSTGRES_MAX_OPEN_CONNS (%d)", c.MaxOpenConns)
+	}
+	v.min("POSTGRES_CONN_MAX_LIFETIME", c.ConnMaxLifetime, 0)
+	v.oneOf("POSTGRES_LOG", c.LogLevel, "silent", "error", "warn", "info")
+	v.positive("POSTGRES_SLOW_THRESHOLD", c.SlowThreshold)
+	v.min("POSTGRES_LOG_SAMPLE_INITIAL", int64(c.LogSampleInitial), 0)
+	v.min("POSTGRES_LOG_SAMPLE_THEREAFTER", int64(c.LogSampleThereafter), 0)
+	v.oneOf("POSTGRES_SSLMODE", c.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	if (c.SSLMode == "verify-ca" || c.SSLMode == "verify-full") && c.SSLRootCert == "" {
+		v.add("POSTGRES_SSLROOTCERT", "is required with POSTGRES_SSLMODE=%s", c.SSLMode)
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		v.add("POSTGRES_SSLCERT", "must be set together with POSTGRES_SSLKEY")
+	}
+	v.file("POSTGRES_SSLROOTCERT", c.SSLRootCert)
+	v.file("POSTGRES_SSLCERT", c.SSLCert)
+	v.file("POSTGRES_SSLKEY", c.SSLKey)
+	if c.ConnectTimeout < 0 {
+		v.add("POSTGRES_CONNECT_TIMEOUT", "must not be negative")
+	}
+	if c.StatementTimeout < 0 {
+		v.add("POSTGRES_STATEMENT_TIMEOUT", "must not be negative")
+	}
+	for _, host := range c.ReplicaHosts {
+		if strings.TrimSpace(host) == "" {
+			v.add("POSTGRES_REPLICA_HOSTS", "must not contain empty hosts")
+			continue
+		}
+		if _, port, err := net.SplitHostPort(host); err == nil {
+			if p, err := strconv.ParseInt(port, 10, 64); err != nil || p < 1 || p > 65535 {
+				v.add("POSTGRES_REPLICA_HOSTS", "invalid port in %q", host)
+			}
+		}
+	}
+}
+
+func (c *RedisConfig) Validate() error {
+	v := &validator{}
+	c.validate(v)
+	return v.err()
+}
+
+func (c *RedisConfig) validate(v *validator) {
+	switch c.Mode() {
+	case RedisModeCluster:
+		if c.SentinelMaster != "" {
+			v.add("REDIS_SENTINEL_MASTER", "must not be set together with REDIS_CLUSTER_ADDRS")
+		}
+		if c.DB != 0 {
+			v.add("REDIS_DB", "must be 0 in cluster mode, got %d", c.DB)
+		}
+		for _, addr := range c.ClusterAddrs {
+			v.hostPort("REDIS_CLUSTER_ADDRS", addr)
+		}
+	case RedisModeSentinel:
+		if len(c.SentinelAddrs) == 0 {
+			v.add("REDIS_SENTINEL_ADDRS", "is required with REDIS_SENTINEL_MASTER")
+		}
+		for _, addr := range c.SentinelAddrs {
+			v.hostPort("REDIS_SENTINEL_ADDRS", addr)
+		}
+	default:
+		v.required("REDIS_HOST", c.Host)
+		if port, err := strconv.ParseInt(c.Port, 10, 64); err != nil {
+			v.add("REDIS_PORT", "must be a number, got %q", c.Port)
+		} else {
+			v.port("REDIS_PORT", port)
+		}
+	}
+	if c.DB < 0 || c.DB > 15 {
+		v.add("REDIS_DB", "must be between 0 and 15, got %d", c.DB)
+	}
+	v.min("REDIS_POOL_SIZE", int64(c.PoolSize), 0)
+	v.min("REDIS_MAX_IDLE_CONNS", int64(c.MinIdleConns), 0)
+
+	if !c.TLSEnabled && (c.TLSCACert != "" || c.TLSCert != "") {
+		v.add("REDIS_TLS", "must be true when TLS certificates are configured")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		v.add("REDIS_TLS_CERT", "must be set together with REDIS_TLS_KEY")
+	}
+	v.file("REDIS_TLS_CA_CERT", c.TLSCACert)
+	v.file("REDIS_TLS_CERT", c.TLSCert)
+	v.file("REDIS_TLS_KEY", c.TLSKey)
+
+	v.positive("REDIS_DIAL_TIMEOUT", c.DialTimeout)
+	v.positive("REDIS_READ_TIMEOUT", c.ReadTimeout)
+	v.positive("REDIS_WRITE_TIMEOUT", c.WriteTimeout)
+	// go-redis treats -1 as "no retries"
+	v.min("REDIS_MAX_RETRIES", int64(c.MaxRetries), -1)
+	if c.MaxRetryBackoff < c.MinRetryBackoff {
+		v.add("REDIS_MAX_RETRY_BACKOFF", "must not be below REDIS_MIN_RETRY_BACKOFF (%s)", c.MinRetryBackoff)
+	}
+}
+
+// parseErrors turns the env library's aggregate into Errors
+func parseErrors(err error) Errors {
+	var agg env.AggregateError
+	if !errors.As(err, &agg) {
+		return Errors{{Message: err.Error()}}
+	}
+
+	out := make(Errors, 0, len(agg.Errors))
+	for _, e := range agg.Errors {
+		out = append(out, FieldError{Message: e.Error()})
+	}
+	return out
+}
+
+func (c *BotConfig) validate(v *validator) {
+	if c.ChannelLogPanel != 0 {
+		v.required("TELEGRAM_BOT_TOKEN", c.Token)
+		if u, err := url.Parse(c.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("TELEGRAM_API_URL", "must be an http(s) URL")
+		}
+		v.positive("TELEGRAM_LOG_FLUSH_INTERVAL", c.LogFlushInterval)
+		if c.LogDedupWindow < 0 {
+			v.add("TELEGRAM_LOG_DEDUP_WINDOW", "must not be negative, got %s", c.LogDedupWindow)
+		}
+		v.min("TELEGRAM_LOG_RATE_LIMIT", int64(c.LogRateLimit), 1)
+	}
+	if c.Token == "" {
+		return
+	}
+	id, secret, ok := strings.Cut(c.Token, ":")
+	if _, err := strconv.ParseInt(id, 10, 64); !ok || err != nil || secret == "" {
+		v.add("TELEGRAM_BOT_TOKEN", "must look like <bot id>:<secret>")
+	}
+}
+
+func (c *JWTConfig) validate(v *validator) {
+	if c.Secret != "" && len(c.Secret) < 32 {
+		v.add("JWT_SECRET", "must be at least 32 bytes")
+	}
+	if c.Secret != "" && c.PrivateKey != "" {
+		v.add("JWT_PRIVATE_KEY", "must not be set together with JWT_SECRET")
+	}
+	v.required("JWT_KEY_ID", c.KeyID)
+	v.positive("JWT_ACCESS_TTL", c.AccessTTL)
+	v.positive("JWT_REFRESH_TTL", c.RefreshTTL)
+	v.positive("JWT_SERVICE_TTL", c.ServiceTTL)
+	v.min("JWT_LEEWAY", int64(c.Leeway), 0)
+	for svc, key := range c.ServicePublicKeys {
+		if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != ed25519.PublicKeySize {
+			v.add("JWT_SERVICE_PUBLIC_KEYS", "key of %q must be a base64 Ed25519 public key", svc)
+		}
+	}
+}
+
+var logLevels = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+
+func (c *LogConfig) validate(v *validator) {
+	v.oneOf("LOG_LEVEL", c.Level, logLevels...)
+	if c.Encoding != "" {
+		v.oneOf("LOG_ENCODING", c.Encoding, "json", "console")
+	}
+	for module, level := range c.Modules {
+		v.oneOf("LOG_MODULES", level, logLevels...)
+		if module == "" {
+			v.add("LOG_MODULES", "module name must not be empty")
+		}
+	}
+	v.min("LOG_SAMPLING_INITIAL", int64(c.SamplingInitial), 0)
+	v.min("LOG_SAMPLING_THEREAFTER", int64(c.SamplingThereafter), 0)
+	if c.SamplingInitial > 0 {
+		v.positive("LOG_SAMPLING_TICK", c.SamplingTick)
+	}
+	if c.AdminAddr != "" {
+		v.hostPort("LOG_ADMIN_ADDR", c.AdminAddr)
+	}
+}
+
+func (c *MetricsConfig) validate(v *validator) {
+	if !c.Enabled {
+		return
+	}
+	v.hostPort("METRICS_ADDR", c.Addr)
+	if !strings.HasPrefix(c.Path, "/") {
+		v.add("METRICS_PATH", "must start with /")
+	}
+	if c.Namespace != "" && !metricNamespace.MatchString(c.Namespace) {
+		v.add("METRICS_NAMESPACE", "must match %s", metricNamespace)
+	}
+}
+
+var metricNamespace = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (c *HTTPConfig) validate(v *validator) {
+	v.hostPort("HTTP_ADDR", c.Addr)
+	v.positive("HTTP_READ_TIMEOUT", c.ReadTimeout)
+	v.positive("HTTP_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout)
+	v.positive("HTTP_WRITE_TIMEOUT", c.WriteTimeout)
+	v.positive("HTTP_IDLE_TIMEOUT", c.IdleTimeout)
+	v.positive("HTTP_SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	v.min("HTTP_MAX_HEADER_BYTES", int64(c.MaxHeaderBytes), 1024)
+}
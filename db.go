@@ -1,9 +1,9 @@
 package shared
 
 import (
-	"fmt"
+	"github.com/walletYabPangu/shared/config"
 	"github.com/walletYabPangu/shared/models"
-	"gorm.io/driver/postgres"
+	"github.com/walletYabPangu/shared/pkg/database"
 	"gorm.io/gorm"
 	"log"
 )
@@ -17,9 +17,8 @@ type IDatabase interface {
 	ConnectAndMigrate() error
 }
 
-func InitDb(Data *DbConfig) IDatabase {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable", Data.Host, Data.User, Data.Password, Data.DBName, Data.Port)
-	dbi, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func InitDb(Data *config.DbConfig) IDatabase {
+	dbi, err := database.NewGORM(*Data)
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
@@ -1,17 +1,285 @@
 package shared
 
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/walletYabPangu/shared/config"
+)
+
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenInvalid          = errors.New("token is invalid")
+)
+
+const (
+	defaultTokenTTL = 15 * time.Minute
+	defaultIssuer   = "auth"
+)
+
+// Claims carried by every access token issued by the platform
+type Claims struct {
+	UserID     uint64   `json:"uid"`
+	TelegramID int64    `json:"tid,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// HasRole reports whether the token was issued with the given role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type JWT struct {
-	Key string
+	Keys        *KeySet
+	ServiceKeys *KeySet
+	Issuer      string
+	Audience    []string
+	TTL         time.Duration
+	ServiceTTL  time.Duration
+	Leeway      time.Duration
+	Revoker     TokenRevoker
+
+	now func() time.Time
 }
 
 type IJWT interface {
-	GenerateToken(userID uint)
+	GenerateToken(userID uint64, telegramID int64, roles []string) (string, error)
+	ParseToken(ctx context.Context, token string) (*Claims, error)
+	GenerateServiceToken(source, target string) (string, error)
+	ParseServiceToken(ctx context.Context, token, self string) (*ServiceClaims, error)
+}
+
+type JwtOption func(*JWT)
+
+// WithIssuer sets the "iss" claim written and expected by the JWT
+func WithIssuer(issuer string) JwtOption {
+	return func(j *JWT) { j.Issuer = issuer }
+}
+
+// WithAudience sets the "aud" claim written and expected by the JWT
+func WithAudience(audience ...string) JwtOption {
+	return func(j *JWT) { j.Audience = audience }
+}
+
+// WithTTL sets the lifetime of issued access tokens
+func WithTTL(ttl time.Duration) JwtOption {
+	return func(j *JWT) { j.TTL = ttl }
+}
+
+// WithKeySet replaces the single key passed to JwtNew with a rotating
+// key set. Pass an empty key to JwtNew when using it.
+func WithKeySet(keys *KeySet) JwtOption {
+	return func(j *JWT) { j.Keys = keys }
+}
+
+// WithRevocation makes ParseToken reject tokens denied by revoker
+func WithRevocation(revoker TokenRevoker) JwtOption {
+	return func(j *JWT) { j.Revoker = revoker }
+}
+
+// WithLeeway allows for clock skew between services when validating
+func WithLeeway(leeway time.Duration) JwtOption {
+	return func(j *JWT) { j.Leeway = leeway }
 }
 
-func JwtNew(Key string) {
+// JwtNew creates a JWT signing with the HS256 secret Key under the
+// DefaultKeyID, unless a key set is supplied through WithKeySet.
+func JwtNew(Key string, opts ...JwtOption) *JWT {
+	keys, _ := NewKeySet()
+	if Key != "" {
+		_ = keys.Add(NewHMACKey(DefaultKeyID, []byte(Key)))
+	}
 
+	j := &JWT{
+		Keys:       keys,
+		Issuer:     defaultIssuer,
+		TTL:        defaultTokenTTL,
+		ServiceTTL: defaultServiceTokenTTL,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
 }
 
-func (j *JWT) GenerateToken(userID uint) {
+// JwtFromConfig builds a JWT from the JWT section of the shared config.
+// Service tokens are enabled when JWT_SERVICE_PRIVATE_KEY or
+// JWT_SERVICE_PUBLIC_KEYS is set; the private key belongs to svc.Name.
+func JwtFromConfig(svc config.ServiceConfig, cfg config.JWTConfig) (*JWT, error) {
+	var key *SigningKey
+	switch {
+	case cfg.PrivateKey != "":
+		k, err := ParsePrivateKeyPEM(cfg.KeyID, []byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	case cfg.Secret != "":
+		key = NewHMACKey(cfg.KeyID, []byte(cfg.Secret))
+	default:
+		return nil, errors.New("jwt: JWT_SECRET or JWT_PRIVATE_KEY is required")
+	}
+
+	keys, err := NewKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceKeys, err := serviceKeysFromConfig(svc.Name, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return JwtNew("",
+		WithKeySet(keys),
+		WithServiceKeys(serviceKeys),
+		WithIssuer(cfg.Issuer),
+		WithAudience(cfg.Audience...),
+		WithTTL(cfg.AccessTTL),
+		WithServiceTTL(cfg.ServiceTTL),
+		WithLeeway(cfg.Leeway),
+	), nil
+}
+
+func serviceKeysFromConfig(self string, cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.ServicePrivateKey == "" && len(cfg.ServicePublicKeys) == 0 {
+		return nil, nil
+	}
+
+	keys, _ := NewKeySet()
+	for name, encoded := range cfg.ServicePublicKeys {
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwt: invalid public key of service %s", name)
+		}
+		if err := keys.Add(NewEd25519PublicKey(ServiceKeyID(name), ed25519.PublicKey(raw))); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ServicePrivateKey != "" {
+		if self == "" {
+			return nil, errors.New("jwt: SERVICE_NAME is required with JWT_SERVICE_PRIVATE_KEY")
+		}
+		key, err := ParsePrivateKeyPEM(ServiceKeyID(self), []byte(cfg.ServicePrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		// Peers only hold Ed25519 public keys, so they could not verify
+		// anything else
+		if key.Algorithm != AlgEdDSA {
+			return nil, fmt.Errorf("%w: JWT_SERVICE_PRIVATE_KEY must be Ed25519, not %s", ErrUnsupportedAlg, key.Algorithm)
+		}
+		if err := keys.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (j *JWT) GenerateToken(userID uint64, telegramID int64, roles []string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := j.timeNow()
+	claims := Claims{
+		UserID:     userID,
+		TelegramID: telegramID,
+		Roles:      roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatUint(userID, 10),
+			Issuer:    j.Issuer,
+			Audience:  j.Audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.TTL)),
+		},
+	}
+
+	return j.Keys.sign(claims)
+}
+
+// ParseToken verifies the signature and registered claims of token
+// and returns its claims. Errors wrap one of the ErrToken* values.
+// When a revoker is configured, revoked tokens fail with ErrTokenRevoked.
+func (j *JWT) ParseToken(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, j.Keys.keyfunc, j.parserOptions()...)
+	if err != nil {
+		return nil, classifyTokenError(err)
+	}
+
+	// Service tokens carry no user and must never pass as access tokens
+	if claims.UserID == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	if j.Revoker != nil {
+		revoked, err := j.Revoker.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: revocation check failed: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+func (j *JWT) timeNow() time.Time {
+	if j.now == nil {
+		return time.Now()
+	}
+	return j.now()
+}
+
+func (j *JWT) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(j.Keys.algorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(j.Leeway),
+		jwt.WithTimeFunc(j.timeNow),
+	}
+	if j.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.Issuer))
+	}
+	if len(j.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(j.Audience...))
+	}
+	return opts
+}
 
+func classifyTokenError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return errors.Join(ErrTokenMalformed, err)
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return errors.Join(ErrTokenExpired, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable),
+		errors.Is(err, ErrKeyNotFound):
+		return errors.Join(ErrTokenSignatureInvalid, err)
+	default:
+		return errors.Join(ErrTokenInvalid, err)
+	}
 }
@@ -0,0 +1,379 @@
+package shared
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	// DefaultKeyID is used for the key passed directly to JwtNew
+	DefaultKeyID = "default"
+)
+
+var (
+	ErrKeyNotFound    = errors.New("jwt: key not found")
+	ErrNoActiveKey    = errors.New("jwt: no active signing key")
+	ErrKeyVerifyOnly  = errors.New("jwt: key has no private part")
+	ErrUnsupportedAlg = errors.New("jwt: unsupported algorithm")
+)
+
+// SigningKey is one entry of a KeySet. Verification-only keys
+// (e.g. loaded from a JWKS document) leave the private part nil.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+
+	secret  []byte
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+func NewHMACKey(kid string, secret []byte) *SigningKey {
+	return &SigningKey{ID: kid, Algorithm: AlgHS256, secret: secret}
+}
+
+func NewEd25519Key(kid string, private ed25519.PrivateKey) *SigningKey {
+	return &SigningKey{ID: kid, Algorithm: AlgEdDSA, private: private, public: private.Public()}
+}
+
+func NewEd25519PublicKey(kid string, public ed25519.PublicKey) *SigningKey {
+	return &SigningKey{ID: kid, Algorithm: AlgEdDSA, public: public}
+}
+
+func NewRSAKey(kid string, private *rsa.PrivateKey) *SigningKey {
+	return &SigningKey{ID: kid, Algorithm: AlgRS256, private: private, public: &private.PublicKey}
+}
+
+func NewRSAPublicKey(kid string, public *rsa.PublicKey) *SigningKey {
+	return &SigningKey{ID: kid, Algorithm: AlgRS256, public: public}
+}
+
+// ParsePrivateKeyPEM reads a PKCS#8 Ed25519 or RSA key, or a PKCS#1 RSA key
+func ParsePrivateKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			return NewEd25519Key(kid, k), nil
+		case *rsa.PrivateKey:
+			return NewRSAKey(kid, k), nil
+		default:
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlg, key)
+		}
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: invalid private key: %w", err)
+	}
+	return NewRSAKey(kid, key), nil
+}
+
+// CanSign reports whether the key holds the material needed for signing
+func (k *SigningKey) CanSign() bool {
+	if k.Algorithm == AlgHS256 {
+		return len(k.secret) > 0
+	}
+	return k.private != nil
+}
+
+func (k *SigningKey) method() (jwt.SigningMethod, error) {
+	switch k.Algorithm {
+	case AlgHS256:
+		return jwt.SigningMethodHS256, nil
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, k.Algorithm)
+	}
+}
+
+func (k *SigningKey) signingMaterial() (interface{}, error) {
+	if !k.CanSign() {
+		return nil, fmt.Errorf("%w: %s", ErrKeyVerifyOnly, k.ID)
+	}
+	if k.Algorithm == AlgHS256 {
+		return k.secret, nil
+	}
+	return k.private, nil
+}
+
+func (k *SigningKey) verificationMaterial() interface{} {
+	if k.Algorithm == AlgHS256 {
+		return k.secret
+	}
+	return k.public
+}
+
+// KeySet holds every key a service accepts, identified by the "kid"
+// header, and the one key currently used for signing.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	activeID string
+}
+
+func NewKeySet(keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, k := range keys {
+		if err := ks.Add(k); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Add registers a key for verification. The first signing-capable key
+// added becomes active unless SetActive is called.
+func (ks *KeySet) Add(key *SigningKey) error {
+	if key == nil || key.ID == "" {
+		return errors.New("jwt: key id is required")
+	}
+	if _, err := key.method(); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys[key.ID] = key
+	if ks.activeID == "" && key.CanSign() {
+		ks.activeID = key.ID
+	}
+	return nil
+}
+
+// SetActive switches signing to kid. Tokens signed with the previous
+// key remain valid until it is removed.
+func (ks *KeySet) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("%w: %s", ErrKeyVerifyOnly, kid)
+	}
+	ks.activeID = kid
+	return nil
+}
+
+// Remove drops a key; tokens signed with it stop verifying
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	delete(ks.keys, kid)
+	if ks.activeID == kid {
+		ks.activeID = ""
+	}
+}
+
+func (ks *KeySet) Active() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[ks.activeID]
+	if !ok {
+		return nil, ErrNoActiveKey
+	}
+	return key, nil
+}
+
+func (ks *KeySet) Get(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	return key, nil
+}
+
+func (ks *KeySet) algorithms() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	seen := map[string]bool{}
+	algs := make([]string, 0, 3)
+	for _, k := range ks.keys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	return algs
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key, err := ks.Active()
+	if err != nil {
+		return "", err
+	}
+	return signWith(key, claims)
+}
+
+func signWith(key *SigningKey, claims jwt.Claims) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+	material, err := key.signingMaterial()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(material)
+}
+
+// keyfunc resolves the verification key from the token's "kid" header.
+// Tokens without a kid are checked against the active key.
+func (ks *KeySet) keyfunc(t *jwt.Token) (interface{}, error) {
+	var (
+		key *SigningKey
+		err error
+	)
+	if kid, _ := t.Header["kid"].(string); kid != "" {
+		key, err = ks.Get(kid)
+	} else {
+		key, err = ks.Active()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Never let the token choose how a key is interpreted
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("%w: token alg %s does not match key %s", ErrUnsupportedAlg, t.Method.Alg(), key.ID)
+	}
+	return key.verificationMaterial(), nil
+}
+
+// ============================================
+// JWKS export / import
+// ============================================
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Symmetric keys are never
+// exported; services verifying HS256 tokens must share the secret.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	out := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		switch pub := k.public.(type) {
+		case ed25519.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "OKP", Kid: k.ID, Alg: AlgEdDSA, Use: "sig", Crv: "Ed25519",
+				X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "RSA", Kid: k.ID, Alg: AlgRS256, Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].Kid < out.Keys[j].Kid })
+	return out
+}
+
+// ServeHTTP serves the set as a JWKS document, e.g. on /.well-known/jwks.json
+func (ks *KeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(ks.JWKS())
+}
+
+// ParseJWKS builds a verification-only KeySet from a JWKS document
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc JWKS
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwt: invalid jwks: %w", err)
+	}
+
+	ks, _ := NewKeySet()
+	for _, jwk := range doc.Keys {
+		key, err := jwk.signingKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+func (k JWK) signingKey() (*SigningKey, error) {
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedAlg, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwt: invalid Ed25519 key %s", k.Kid)
+		}
+		return NewEd25519PublicKey(k.Kid, ed25519.PublicKey(x)), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid RSA modulus for %s", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 {
+			return nil, fmt.Errorf("jwt: invalid RSA exponent for %s", k.Kid)
+		}
+		return NewRSAPublicKey(k.Kid, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedAlg, k.Kty)
+	}
+}
@@ -0,0 +1,200 @@
+package shared
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newEd25519Key(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEd25519Key(kid, private)
+}
+
+func newRSAKey(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRSAKey(kid, private)
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	keys, err := NewKeySet(newEd25519Key(t, "2025-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := JwtNew("", WithKeySet(keys))
+
+	old, err := j.GenerateToken(42, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keys.Add(newEd25519Key(t, "2025-02")); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetActive("2025-02"); err != nil {
+		t.Fatal(err)
+	}
+	current, err := j.GenerateToken(42, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKid(t, current); kid != "2025-02" {
+		t.Fatalf("new token signed with %q", kid)
+	}
+	if _, err := j.ParseToken(ctx, old); err != nil {
+		t.Fatalf("token of the previous key rejected after SetActive: %v", err)
+	}
+
+	keys.Remove("2025-01")
+	if _, err := j.ParseToken(ctx, old); !errors.Is(err, ErrKeyNotFound) || !errors.Is(err, ErrTokenSignatureInvalid) {
+		t.Fatalf("token of a removed key: got %v, want ErrKeyNotFound", err)
+	}
+	if _, err := j.ParseToken(ctx, current); err != nil {
+		t.Fatalf("token of the active key rejected: %v", err)
+	}
+
+	if err := keys.SetActive("2025-01"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("SetActive on a removed key: %v", err)
+	}
+	if err := keys.Add(NewEd25519PublicKey("verify-only", ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetActive("verify-only"); !errors.Is(err, ErrKeyVerifyOnly) {
+		t.Errorf("SetActive on a public key: %v", err)
+	}
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// The token must never pick how a key is used
+func TestKeyfuncRejectsAlgorithmMismatch(t *testing.T) {
+	ed := newEd25519Key(t, "ed")
+	rsaKey := newRSAKey(t, "rsa")
+	keys, err := NewKeySet(ed, rsaKey, NewHMACKey("hmac", []byte(testSecret)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+	}{
+		{"RS256 on EdDSA key", jwt.SigningMethodRS256, "ed"},
+		{"HS256 on RSA key", jwt.SigningMethodHS256, "rsa"},
+		{"HS256 on EdDSA key", jwt.SigningMethodHS256, "ed"},
+		{"EdDSA on HMAC key", jwt.SigningMethodEdDSA, "hmac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &jwt.Token{Method: tt.method, Header: map[string]interface{}{"alg": tt.method.Alg(), "kid": tt.kid}}
+			if _, err := keys.keyfunc(token); !errors.Is(err, ErrUnsupportedAlg) {
+				t.Fatalf("got %v, want ErrUnsupportedAlg", err)
+			}
+		})
+	}
+
+	// The classic confusion attack: HMAC keyed with the public RSA key
+	der, err := x509.MarshalPKIXPublicKey(rsaKey.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 42, RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    defaultIssuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}})
+	forged.Header["kid"] = "rsa"
+	for _, secret := range [][]byte{der, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})} {
+		signed, err := forged.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := JwtNew("", WithKeySet(keys)).ParseToken(context.Background(), signed); !errors.Is(err, ErrUnsupportedAlg) {
+			t.Fatalf("HS256 token keyed with the RSA public key: got %v, want ErrUnsupportedAlg", err)
+		}
+	}
+}
+
+func TestJWKSRoundTrip(t *testing.T) {
+	ed := newEd25519Key(t, "ed")
+	rsaKey := newRSAKey(t, "rsa")
+	keys, err := NewKeySet(ed, rsaKey, NewHMACKey("hmac", []byte(testSecret)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := json.Marshal(keys.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(doc), `"hmac"`) || strings.Contains(string(doc), testSecret) {
+		t.Fatalf("JWKS exports the HS256 secret: %s", doc)
+	}
+	if n := len(keys.JWKS().Keys); n != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", n)
+	}
+
+	parsed, err := ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := JwtNew("", WithKeySet(parsed))
+	for _, key := range []*SigningKey{ed, rsaKey} {
+		got, err := parsed.Get(key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Algorithm != key.Algorithm || got.CanSign() {
+			t.Errorf("%s: alg %s, can sign %v", key.ID, got.Algorithm, got.CanSign())
+		}
+
+		token, err := JwtNew("", WithKeySet(mustKeySet(t, key))).GenerateToken(42, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.ParseToken(context.Background(), token); err != nil {
+			t.Errorf("%s: token rejected by the imported key: %v", key.ID, err)
+		}
+	}
+	if _, err := parsed.Get("hmac"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("HS256 key imported: %v", err)
+	}
+}
+
+func mustKeySet(t *testing.T, keys ...*SigningKey) *KeySet {
+	t.Helper()
+	ks, err := NewKeySet(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
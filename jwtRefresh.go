@@ -0,0 +1,314 @@
+package shared
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/redis"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+const (
+	defaultRefreshTTL = 30 * 24 * time.Hour
+
+	SecurityEventRefreshReuse = "refresh_token_reuse"
+)
+
+// RefreshSession describes the owner of a refresh token
+type RefreshSession struct {
+	UserID   uint64
+	DeviceID string
+	FamilyID string
+}
+
+// RefreshMeta is recorded on security events raised during rotation
+type RefreshMeta struct {
+	IPAddress string
+	UserAgent string
+}
+
+// RefreshTokenStore keeps opaque refresh tokens in Redis. Tokens issued
+// from one login form a family; every rotation adds a token to the
+// family and marks the previous one used. Presenting a used token
+// revokes the whole family.
+//
+// All keys of a user share the hash tag {<user id>}, so the multi-key
+// commands below stay in one slot in cluster mode. Tokens are prefixed
+// with the user ID for the same reason.
+type RefreshTokenStore struct {
+	client *redis.Client
+	db     *gorm.DB
+	ttl    time.Duration
+}
+
+// NewRefreshTokenStore creates a store. db is used to record
+// SecurityEvent rows and may be nil.
+func NewRefreshTokenStore(client *redis.Client, db *gorm.DB, ttl time.Duration) *RefreshTokenStore {
+	if ttl <= 0 {
+		ttl = defaultRefreshTTL
+	}
+	return &RefreshTokenStore{client: client, db: db, ttl: ttl}
+}
+
+// userSlot is the cluster hash tag of every key of a user
+func userSlot(userID uint64) string {
+	return "{" + strconv.FormatUint(userID, 10) + "}"
+}
+
+func refreshTokenKey(userID uint64, hash string) string {
+	return "refresh:" + userSlot(userID) + ":token:" + hash
+}
+func refreshFamilyKey(userID uint64, fid string) string {
+	return "refresh:" + userSlot(userID) + ":family:" + fid
+}
+func refreshUserKey(userID uint64) string {
+	return "refresh:" + userSlot(userID) + ":user"
+}
+func refreshDeviceKey(userID uint64, deviceID string) string {
+	return "refresh:" + userSlot(userID) + ":device:" + deviceID
+}
+
+// refreshTokenUser reads the user ID prefix of a token; the rest is
+// random and checked through the stored hash
+func refreshTokenUser(token string) (uint64, bool) {
+	prefix, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.ParseUint(prefix, 10, 64)
+	return userID, err == nil && userID != 0
+}
+
+// Issue starts a new token family for the device, revoking any family
+// the device held before.
+func (s *RefreshTokenStore) Issue(ctx context.Context, userID uint64, deviceID string) (string, error) {
+	prev, err := s.client.Get(ctx, refreshDeviceKey(userID, deviceID)).Result()
+	switch {
+	case err == nil:
+		if err := s.RevokeFamily(ctx, userID, prev); err != nil {
+			return "", err
+		}
+	case !errors.Is(err, goredis.Nil):
+		// Going on would leave the previous family of the device alive
+		return "", err
+	}
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := s.store(ctx, RefreshSession{UserID: userID, DeviceID: deviceID, FamilyID: familyID})
+	if err != nil {
+		return "", err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, refreshDeviceKey(userID, deviceID), familyID, s.ttl)
+	pipe.SAdd(ctx, refreshUserKey(userID), familyID)
+	pipe.Expire(ctx, refreshUserKey(userID), s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Lua script marking a token used: returns {status, user, device, family}
+// with status 1 on success, -1 if already used and 0 if unknown.
+const luaRefreshConsume = `
+    local fields = redis.call('HMGET', KEYS[1], 'user_id', 'device_id', 'family_id', 'used')
+    if not fields[1] then
+        return {0}
+    end
+    if fields[4] == '1' then
+        return {-1, fields[1], fields[2], fields[3]}
+    end
+    redis.call('HSET', KEYS[1], 'used', '1')
+    return {1, fields[1], fields[2], fields[3]}
+`
+
+// Rotate exchanges a refresh token for a new one in the same family
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token string, meta RefreshMeta) (string, *RefreshSession, error) {
+	owner, ok := refreshTokenUser(token)
+	if !ok {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+	res, err := s.client.Eval(ctx, luaRefreshConsume, []string{refreshTokenKey(owner, hashToken(token))}).Slice()
+	if err != nil {
+		return "", nil, err
+	}
+
+	status, session, err := parseConsumeResult(res)
+	if err != nil {
+		return "", nil, err
+	}
+	if status == 0 {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+
+	if status == -1 {
+		if err := s.RevokeFamily(ctx, session.UserID, session.FamilyID); err != nil {
+			return "", nil, err
+		}
+		s.recordReuse(ctx, session, meta)
+		return "", nil, ErrRefreshTokenReused
+	}
+
+	next, err := s.store(ctx, *session)
+	if err != nil {
+		return "", nil, err
+	}
+	s.client.Expire(ctx, refreshDeviceKey(session.UserID, session.DeviceID), s.ttl)
+
+	return next, session, nil
+}
+
+// parseConsumeResult reads the reply of luaRefreshConsume
+func parseConsumeResult(res []interface{}) (int64, *RefreshSession, error) {
+	if len(res) == 0 {
+		return 0, nil, errors.New("refresh: empty script reply")
+	}
+	status, ok := res[0].(int64)
+	if !ok {
+		return 0, nil, fmt.Errorf("refresh: unexpected script status %T", res[0])
+	}
+	if status == 0 {
+		return 0, nil, nil
+	}
+
+	if len(res) != 4 {
+		return 0, nil, fmt.Errorf("refresh: script returned %d values, want 4", len(res))
+	}
+	fields := make([]string, 3)
+	for i := range fields {
+		v, ok := res[i+1].(string)
+		if !ok {
+			return 0, nil, fmt.Errorf("refresh: unexpected script value %T", res[i+1])
+		}
+		fields[i] = v
+	}
+	userID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, nil, ErrRefreshTokenInvalid
+	}
+	return status, &RefreshSession{UserID: userID, DeviceID: fields[1], FamilyID: fields[2]}, nil
+}
+
+// RevokeFamily invalidates every token issued from one login
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, userID uint64, familyID string) error {
+	hashes, err := s.client.SMembers(ctx, refreshFamilyKey(userID, familyID)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(hashes)+1)
+	for _, h := range hashes {
+		keys = append(keys, refreshTokenKey(userID, h))
+	}
+	keys = append(keys, refreshFamilyKey(userID, familyID))
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.SRem(ctx, refreshUserKey(userID), familyID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUser invalidates every refresh token of the user on all devices
+func (s *RefreshTokenStore) RevokeUser(ctx context.Context, userID uint64) error {
+	families, err := s.client.SMembers(ctx, refreshUserKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, fid := range families {
+		if err := s.RevokeFamily(ctx, userID, fid); err != nil {
+			return err
+		}
+	}
+	return s.client.Del(ctx, refreshUserKey(userID)).Err()
+}
+
+func (s *RefreshTokenStore) store(ctx context.Context, session RefreshSession) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := strconv.FormatUint(session.UserID, 10) + "." + secret
+	hash := hashToken(token)
+	tokenKey := refreshTokenKey(session.UserID, hash)
+	familyKey := refreshFamilyKey(session.UserID, session.FamilyID)
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, tokenKey,
+		"user_id", strconv.FormatUint(session.UserID, 10),
+		"device_id", session.DeviceID,
+		"family_id", session.FamilyID,
+		"used", "0",
+	)
+	pipe.Expire(ctx, tokenKey, s.ttl)
+	pipe.SAdd(ctx, familyKey, hash)
+	pipe.Expire(ctx, familyKey, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *RefreshTokenStore) recordReuse(ctx context.Context, session *RefreshSession, meta RefreshMeta) {
+	if s.db == nil {
+		return
+	}
+
+	details, _ := json.Marshal(map[string]string{
+		"family_id": session.FamilyID,
+		"device_id": session.DeviceID,
+	})
+	event := models.SecurityEvent{
+		EventType: SecurityEventRefreshReuse,
+		UserID:    &session.UserID,
+		Severity:  "critical",
+		Details:   datatypes.JSON(details),
+	}
+	if meta.IPAddress != "" {
+		event.IPAddress = &meta.IPAddress
+	}
+	if meta.UserAgent != "" {
+		event.UserAgent = &meta.UserAgent
+	}
+
+	// The family is already revoked; failing to persist the event must
+	// not turn the reuse into a successful refresh.
+	_ = s.db.WithContext(ctx).Create(&event).Error
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,177 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// hashTag is the part of key Redis Cluster hashes to pick the slot
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// Multi-key commands fail with CROSSSLOT in cluster mode unless all
+// keys hash to the same slot
+func TestUserKeysShareSlot(t *testing.T) {
+	const userID = 42
+	keys := []string{
+		refreshTokenKey(userID, "hash"),
+		refreshFamilyKey(userID, "family"),
+		refreshUserKey(userID),
+		refreshDeviceKey(userID, "device"),
+		revokedTokenKey(userID, "jti"),
+		revokedUserKey(userID),
+	}
+	for _, key := range keys {
+		if tag := hashTag(key); tag != "42" {
+			t.Errorf("%s hashes on %q, want the user ID", key, tag)
+		}
+	}
+	if hashTag(refreshTokenKey(43, "hash")) == "42" {
+		t.Error("keys of different users share a slot")
+	}
+}
+
+func TestRefreshTokenUser(t *testing.T) {
+	tests := []struct {
+		token string
+		user  uint64
+		ok    bool
+	}{
+		{"42.c2VjcmV0", 42, true},
+		{"c2VjcmV0", 0, false},
+		{"0.c2VjcmV0", 0, false},
+		{"-1.c2VjcmV0", 0, false},
+		{".c2VjcmV0", 0, false},
+	}
+	for _, tt := range tests {
+		user, ok := refreshTokenUser(tt.token)
+		if user != tt.user || ok != tt.ok {
+			t.Errorf("refreshTokenUser(%q) = %d, %v; want %d, %v", tt.token, user, ok, tt.user, tt.ok)
+		}
+	}
+}
+
+// recordEvents returns a dry-run database collecting the SecurityEvent
+// rows the store would insert
+func recordEvents(t *testing.T) (*gorm.DB, *[]models.SecurityEvent) {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("postgres://test@127.0.0.1:1/test"), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []models.SecurityEvent
+	err = db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		if event, ok := tx.Statement.Dest.(*models.SecurityEvent); ok {
+			events = append(events, *event)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &events
+}
+
+func TestRotateDetectsReuse(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	db, events := recordEvents(t)
+	store := NewRefreshTokenStore(client, db, time.Hour)
+	meta := RefreshMeta{IPAddress: "203.0.113.7", UserAgent: "wallet-ios/3.1"}
+
+	first, err := store.Issue(ctx, 42, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, session, err := store.Rotate(ctx, first, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.UserID != 42 || session.DeviceID != "phone" {
+		t.Fatalf("session = %+v", session)
+	}
+	if len(*events) != 0 {
+		t.Fatalf("security event on a normal rotation: %+v", *events)
+	}
+
+	if _, _, err := store.Rotate(ctx, first, meta); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("second rotation of the same token: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := store.Rotate(ctx, second, meta); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("token of the revoked family: got %v, want ErrRefreshTokenInvalid", err)
+	}
+	if n := client.Exists(ctx, refreshFamilyKey(42, session.FamilyID)).Val(); n != 0 {
+		t.Error("family still stored after reuse")
+	}
+	if client.SIsMember(ctx, refreshUserKey(42), session.FamilyID).Val() {
+		t.Error("family still listed for the user after reuse")
+	}
+
+	if len(*events) != 1 {
+		t.Fatalf("recorded %d security events, want 1", len(*events))
+	}
+	event := (*events)[0]
+	if event.EventType != SecurityEventRefreshReuse || event.Severity != "critical" {
+		t.Errorf("event = %s/%s", event.EventType, event.Severity)
+	}
+	if event.UserID == nil || *event.UserID != 42 {
+		t.Errorf("event user = %v", event.UserID)
+	}
+	if event.IPAddress == nil || *event.IPAddress != meta.IPAddress || event.UserAgent == nil || *event.UserAgent != meta.UserAgent {
+		t.Errorf("event ip = %v, user agent = %v", event.IPAddress, event.UserAgent)
+	}
+	if !strings.Contains(string(event.Details), session.FamilyID) {
+		t.Errorf("event details = %s", event.Details)
+	}
+}
+
+// A failed lookup must not be taken for a device without a family
+func TestIssueFailsOnDeviceLookupError(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	store := NewRefreshTokenStore(client, nil, time.Hour)
+	client.HSet(ctx, refreshDeviceKey(42, "phone"), "family", "fam")
+
+	if _, err := store.Issue(ctx, 42, "phone"); err == nil || errors.Is(err, goredis.Nil) {
+		t.Fatalf("got %v, want the WRONGTYPE error", err)
+	}
+}
+
+func TestParseConsumeResult(t *testing.T) {
+	tests := []struct {
+		name string
+		res  []interface{}
+		ok   bool
+	}{
+		{"unknown", []interface{}{int64(0)}, true},
+		{"used", []interface{}{int64(-1), "42", "phone", "fam"}, true},
+		{"empty", nil, false},
+		{"status type", []interface{}{"1", "42", "phone", "fam"}, false},
+		{"short", []interface{}{int64(1), "42"}, false},
+		{"field type", []interface{}{int64(1), "42", nil, "fam"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseConsumeResult(tt.res); (err == nil) != tt.ok {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/redis"
+)
+
+var ErrTokenRevoked = errors.New("token is revoked")
+
+// TokenRevoker is consulted by JWT.ParseToken when set through WithRevocation
+type TokenRevoker interface {
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// RevocationStore is a Redis denylist of access tokens keyed by jti,
+// plus a per-user cut-off: tokens issued at or before it are rejected.
+// Both keys carry the user's hash tag so IsRevoked reads them with one
+// MGET in cluster mode.
+type RevocationStore struct {
+	client  *redis.Client
+	maxTTL  time.Duration
+	refresh *RefreshTokenStore
+}
+
+// NewRevocationStore creates a store. maxTTL must cover the longest
+// lived access token so per-user cut-offs outlive every token they hit.
+func NewRevocationStore(client *redis.Client, maxTTL time.Duration) *RevocationStore {
+	if maxTTL <= 0 {
+		maxTTL = defaultTokenTTL
+	}
+	return &RevocationStore{client: client, maxTTL: maxTTL, refresh: NewRefreshTokenStore(client, nil, 0)}
+}
+
+func revokedTokenKey(userID uint64, jti string) string {
+	return "revoked:" + userSlot(userID) + ":jti:" + jti
+}
+func revokedUserKey(userID uint64) string {
+	return "revoked:" + userSlot(userID) + ":user"
+}
+
+// RevokeToken denylists one token until it would have expired anyway
+func (s *RevocationStore) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" {
+		return errors.New("jwt: token has no jti")
+	}
+
+	ttl := s.maxTTL
+	if claims.ExpiresAt != nil {
+		ttl = time.Until(claims.ExpiresAt.Time)
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, revokedTokenKey(claims.UserID, claims.ID), 1, ttl).Err()
+}
+
+// RevokeUserBefore rejects every token of the user issued at or before t
+func (s *RevocationStore) RevokeUserBefore(ctx context.Context, userID uint64, t time.Time) error {
+	return s.client.Set(ctx, revokedUserKey(userID), t.Unix(), s.maxTTL).Err()
+}
+
+// ApplyUserStatus revokes all access and refresh tokens of users that
+// are banned, suspended or deleted, so they cannot log back in through
+// a refresh once the cut-off expires. Call it whenever
+// models.User.Status changes.
+func (s *RevocationStore) ApplyUserStatus(ctx context.Context, userID uint64, status models.UserStatus) error {
+	switch status {
+	case models.UserStatusBanned, models.UserStatusSuspended, models.UserStatusDeleted:
+		if err := s.RevokeUserBefore(ctx, userID, time.Now()); err != nil {
+			return err
+		}
+		return s.refresh.RevokeUser(ctx, userID)
+	default:
+		return nil
+	}
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	keys := []string{revokedUserKey(claims.UserID)}
+	if claims.ID != "" {
+		keys = append(keys, revokedTokenKey(claims.UserID, claims.ID))
+	}
+
+	vals, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return false, err
+	}
+
+	if len(vals) > 1 && vals[1] != nil {
+		return true, nil
+	}
+	if cutoff, ok := vals[0].(string); ok && claims.IssuedAt != nil {
+		ts, err := strconv.ParseInt(cutoff, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return claims.IssuedAt.Unix() <= ts, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,74 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/redis"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := &redis.Client{UniversalClient: goredis.NewClient(&goredis.Options{Addr: srv.Addr()})}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestApplyUserStatusRevokesRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	refresh := NewRefreshTokenStore(client, nil, time.Hour)
+	revocation := NewRevocationStore(client, 15*time.Minute)
+	j := JwtNew("0123456789abcdef0123456789abcdef", WithRevocation(revocation))
+
+	banned, err := refresh.Issue(ctx, 42, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := refresh.Issue(ctx, 43, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := j.GenerateToken(42, 1042, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := revocation.ApplyUserStatus(ctx, 42, models.UserStatusBanned); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.ParseToken(ctx, access); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token: got %v, want ErrTokenRevoked", err)
+	}
+	if _, _, err := refresh.Rotate(ctx, banned, RefreshMeta{}); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("refresh after ban: got %v, want ErrRefreshTokenInvalid", err)
+	}
+	if _, _, err := refresh.Rotate(ctx, other, RefreshMeta{}); err != nil {
+		t.Errorf("refresh of another user: %v", err)
+	}
+}
+
+func TestApplyUserStatusActive(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	refresh := NewRefreshTokenStore(client, nil, time.Hour)
+	revocation := NewRevocationStore(client, 15*time.Minute)
+
+	token, err := refresh.Issue(ctx, 42, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := revocation.ApplyUserStatus(ctx, 42, models.UserStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := refresh.Rotate(ctx, token, RefreshMeta{}); err != nil {
+		t.Fatalf("refresh of active user: %v", err)
+	}
+}
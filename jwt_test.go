@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestJWT issues tokens at a fixed time that the test can move
+func newTestJWT(secret string, opts ...JwtOption) (*JWT, *time.Time) {
+	now := time.Unix(1760000000, 0)
+	j := JwtNew(secret, append([]JwtOption{
+		WithIssuer("auth"),
+		WithAudience("wallet"),
+		WithTTL(15 * time.Minute),
+	}, opts...)...)
+	j.now = func() time.Time { return now }
+	return j, &now
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	j, now := newTestJWT(testSecret)
+
+	token, err := j.GenerateToken(42, 1042, []string{"admin", "support"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := j.ParseToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserID != 42 || claims.TelegramID != 1042 || claims.Subject != "42" {
+		t.Errorf("user = %d, telegram = %d, sub = %q", claims.UserID, claims.TelegramID, claims.Subject)
+	}
+	if !reflect.DeepEqual(claims.Roles, []string{"admin", "support"}) || !claims.HasRole("admin") || claims.HasRole("owner") {
+		t.Errorf("roles = %v", claims.Roles)
+	}
+	if claims.Issuer != "auth" || !reflect.DeepEqual([]string(claims.Audience), []string{"wallet"}) {
+		t.Errorf("iss = %q, aud = %v", claims.Issuer, claims.Audience)
+	}
+	if !claims.ExpiresAt.Equal(now.Add(15 * time.Minute)) {
+		t.Errorf("exp = %v, want %v", claims.ExpiresAt, now.Add(15*time.Minute))
+	}
+	if claims.ID == "" {
+		t.Error("token has no jti")
+	}
+}
+
+func TestParseTokenErrors(t *testing.T) {
+	issuer, now := newTestJWT(testSecret)
+	valid, err := issuer.GenerateToken(42, 1042, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(-time.Hour)
+	expired, _ := issuer.GenerateToken(42, 1042, nil)
+	*now = now.Add(time.Hour)
+
+	otherKey, _ := newTestJWT("fedcba9876543210fedcba9876543210")
+	wrongSignature, _ := otherKey.GenerateToken(42, 1042, nil)
+	otherIssuer, _ := newTestJWT(testSecret, WithIssuer("game"))
+	wrongIssuer, _ := otherIssuer.GenerateToken(42, 1042, nil)
+	otherAudience, _ := newTestJWT(testSecret, WithAudience("admin-panel"))
+	wrongAudience, _ := otherAudience.GenerateToken(42, 1042, nil)
+	noUser, _ := issuer.GenerateToken(0, 0, nil)
+
+	parts := strings.Split(valid, ".")
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", expired, ErrTokenExpired},
+		{"empty", "", ErrTokenMalformed},
+		{"not a jwt", "not-a-token", ErrTokenMalformed},
+		{"bad base64", parts[0] + ".!!!." + parts[2], ErrTokenMalformed},
+		{"wrong signature", wrongSignature, ErrTokenSignatureInvalid},
+		{"tampered payload", parts[0] + "." + strings.Split(noUser, ".")[1] + "." + parts[2], ErrTokenSignatureInvalid},
+		{"wrong issuer", wrongIssuer, ErrTokenInvalid},
+		{"wrong audience", wrongAudience, ErrTokenInvalid},
+		{"no user", noUser, ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.ParseToken(context.Background(), tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,59 +1,224 @@
 // shared/pkg/metrics/metrics.go
+
+// Package metrics defines the Prometheus collectors shared by all
+// services.
+//
+// Services built with app get a *Metrics from New on their own registry,
+// labelled with the service, and only that registry is served. The
+// package-level collectors and Default live on the global registry,
+// which app does not serve, so series recorded there are not scraped.
+// To migrate, replace
+//
+//	metrics.HTTPRequestDuration.WithLabelValues(service, method, path, status)
+//
+// with
+//
+//	a.Metrics.HTTPRequestDuration.WithLabelValues(method, path, status)
+//
+// or, outside app, with a *Metrics from New passed to the code that
+// records. Services serving the global registry themselves (promhttp.Handler)
+// keep working until the globals are removed.
 package metrics
 
 import (
+	"errors"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// Metrics holds the collectors shared by all services
+type Metrics struct {
+	HTTPRequestDuration    *prometheus.HistogramVec
+	HTTPRequestsInFlight   *prometheus.GaugeVec
+	HTTPRequestSize        *prometheus.HistogramVec
+	HTTPResponseSize       *prometheus.HistogramVec
+	HTTPPanics             *prometheus.CounterVec
+	DBQueryDuration        *prometheus.HistogramVec
+	RedisOperationDuration *prometheus.HistogramVec
+	ActiveUsers            *prometheus.GaugeVec
+	TasksCompleted         *prometheus.CounterVec
+	ScanCreditsBalance     prometheus.Histogram
+
+	// service is the const "service" label; empty for Default, whose
+	// collectors take it as their first label instead
+	service string
+}
+
+// Default is registered on the global registry and backs the package
+// level collectors. It has no namespace, and the HTTP, DB and Redis
+// collectors take the service as their first label. app serves its own
+// registry, not this one.
+//
+// Deprecated: use New with the registry that is served, see the
+// package documentation.
+var Default = New(prometheus.DefaultRegisterer, "", "")
+
+// The collectors of Default.
+//
+// Deprecated: app does not serve them; use the fields of a *Metrics
+// from New instead.
 var (
-	HTTPRequestDuration = promauto.NewHistogramVec(
+	HTTPRequestDuration    = Default.HTTPRequestDuration
+	HTTPRequestsInFlight   = Default.HTTPRequestsInFlight
+	HTTPRequestSize        = Default.HTTPRequestSize
+	HTTPResponseSize       = Default.HTTPResponseSize
+	HTTPPanics             = Default.HTTPPanics
+	DBQueryDuration        = Default.DBQueryDuration
+	RedisOperationDuration = Default.RedisOperationDuration
+	ActiveUsers            = Default.ActiveUsers
+	TasksCompleted         = Default.TasksCompleted
+	ScanCreditsBalance     = Default.ScanCreditsBalance
+)
+
+// New creates the collectors and registers them on reg. Metric names
+// are prefixed with namespace, and service is added to every metric as
+// a const label. Collectors already registered on reg by an earlier New
+// with the same arguments are reused; other registration errors panic,
+// like promauto.
+func New(reg prometheus.Registerer, namespace, service string) *Metrics {
+	m := &Metrics{service: service}
+	var constLabels prometheus.Labels
+	if service != "" {
+		constLabels = prometheus.Labels{"service": service}
+	}
+
+	m.HTTPRequestDuration = register(reg, prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests",
-			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2, 5},
+			Namespace:   namespace,
+			Name:        "http_request_duration_seconds",
+			Help:        "Duration of HTTP requests",
+			Buckets:     []float64{0.001, 0.01, 0.1, 0.5, 1, 2, 5},
+			ConstLabels: constLabels,
+		},
+		m.labels("method", "path", "status"),
+	))
+
+	m.HTTPRequestsInFlight = register(reg, prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "http_requests_in_flight",
+			Help:        "HTTP requests being served",
+			ConstLabels: constLabels,
 		},
-		[]string{"service", "method", "path", "status"},
-	)
+		m.labels(),
+	))
 
-	DBQueryDuration = promauto.NewHistogramVec(
+	m.HTTPRequestSize = register(reg, prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "db_query_duration_seconds",
-			Help:    "Duration of database queries",
-			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1},
+			Namespace:   namespace,
+			Name:        "http_request_size_bytes",
+			Help:        "Size of HTTP request bodies",
+			Buckets:     prometheus.ExponentialBuckets(100, 10, 6),
+			ConstLabels: constLabels,
 		},
-		[]string{"service", "query"},
-	)
+		m.labels("method", "path"),
+	))
 
-	RedisOperationDuration = promauto.NewHistogramVec(
+	m.HTTPResponseSize = register(reg, prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name: "redis_operation_duration_seconds",
-			Help: "Duration of Redis operations",
+			Namespace:   namespace,
+			Name:        "http_response_size_bytes",
+			Help:        "Size of HTTP response bodies",
+			Buckets:     prometheus.ExponentialBuckets(100, 10, 6),
+			ConstLabels: constLabels,
 		},
-		[]string{"service", "operation"},
-	)
+		m.labels("method", "path", "status"),
+	))
 
-	ActiveUsers = promauto.NewGaugeVec(
+	m.HTTPPanics = register(reg, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "http_panics_recovered_total",
+			Help:        "Panics recovered in HTTP handlers",
+			ConstLabels: constLabels,
+		},
+		m.labels("method", "path"),
+	))
+
+	m.DBQueryDuration = register(reg, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "db_query_duration_seconds",
+			Help:        "Duration of database queries",
+			Buckets:     []float64{0.001, 0.01, 0.1, 0.5, 1},
+			ConstLabels: constLabels,
+		},
+		m.labels("query"),
+	))
+
+	m.RedisOperationDuration = register(reg, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "redis_operation_duration_seconds",
+			Help:        "Duration of Redis operations",
+			ConstLabels: constLabels,
+		},
+		m.labels("operation"),
+	))
+
+	m.ActiveUsers = register(reg, prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "active_users",
-			Help: "Number of active users",
+			Namespace:   namespace,
+			Name:        "active_users",
+			Help:        "Number of active users",
+			ConstLabels: constLabels,
 		},
 		[]string{"timeframe"},
-	)
+	))
 
-	TasksCompleted = promauto.NewCounterVec(
+	m.TasksCompleted = register(reg, prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "tasks_completed_total",
-			Help: "Total number of tasks completed",
+			Namespace:   namespace,
+			Name:        "tasks_completed_total",
+			Help:        "Total number of tasks completed",
+			ConstLabels: constLabels,
 		},
 		[]string{"task_type"},
-	)
+	))
 
-	ScanCreditsBalance = promauto.NewHistogram(
+	m.ScanCreditsBalance = register(reg, prometheus.NewHistogram(
 		prometheus.HistogramOpts{
-			Name:    "scan_credits_balance",
-			Help:    "Distribution of user scan credit balances",
-			Buckets: []float64{0, 10, 50, 100, 500, 1000, 5000},
+			Namespace:   namespace,
+			Name:        "scan_credits_balance",
+			Help:        "Distribution of user scan credit balances",
+			Buckets:     []float64{0, 10, 50, 100, 500, 1000, 5000},
+			ConstLabels: constLabels,
 		},
-	)
-)
+	))
+
+	return m
+}
+
+// LabelValues orders values for the collectors with a service label:
+// Default takes service first, instances from New ignore it since it is
+// a const label there
+func (m *Metrics) LabelValues(service string, values ...string) []string {
+	if m.service != "" {
+		return values
+	}
+	return append([]string{service}, values...)
+}
+
+// labels prepends "service" when it is not a const label
+func (m *Metrics) labels(names ...string) []string {
+	if m.service != "" {
+		return names
+	}
+	return append([]string{"service"}, names...)
+}
+
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if reg == nil {
+		return c
+	}
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewOnSeparateRegistries(t *testing.T) {
+	a := New(prometheus.NewRegistry(), "", "auth")
+	b := New(prometheus.NewRegistry(), "", "auth")
+	if a.HTTPRequestDuration == b.HTTPRequestDuration {
+		t.Fatal("separate registries share collectors")
+	}
+
+	a.TasksCompleted.WithLabelValues("scan").Inc()
+	if n := testutil.ToFloat64(b.TasksCompleted.WithLabelValues("scan")); n != 0 {
+		t.Errorf("counter of the other registry = %v, want 0", n)
+	}
+}
+
+func TestNewTwiceOnOneRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first := New(reg, "wallet", "auth")
+	again := New(reg, "wallet", "auth")
+	if first.HTTPRequestDuration != again.HTTPRequestDuration || first.ScanCreditsBalance != again.ScanCreditsBalance {
+		t.Error("same arguments did not reuse the registered collectors")
+	}
+
+	// Other services on the same registry get series of their own
+	game := New(reg, "wallet", "game")
+	first.TasksCompleted.WithLabelValues("scan").Inc()
+	game.TasksCompleted.WithLabelValues("scan").Add(2)
+
+	if n, err := testutil.GatherAndCount(reg, "wallet_tasks_completed_total"); err != nil || n != 2 {
+		t.Fatalf("gathered %d series, %v; want one per service", n, err)
+	}
+	if n := testutil.ToFloat64(game.TasksCompleted.WithLabelValues("scan")); n != 2 {
+		t.Errorf("game tasks = %v, want 2", n)
+	}
+
+	// A different label set under the same names cannot be registered
+	defer func() {
+		if recover() == nil {
+			t.Error("New without service on a registry with service const labels did not panic")
+		}
+	}()
+	New(reg, "wallet", "")
+}
+
+func TestLabelValues(t *testing.T) {
+	labelled := New(prometheus.NewRegistry(), "", "auth")
+	if got := labelled.LabelValues("game", "GET", "/users"); !reflect.DeepEqual(got, []string{"GET", "/users"}) {
+		t.Errorf("with const label: %v", got)
+	}
+	unlabelled := New(prometheus.NewRegistry(), "", "")
+	if got := unlabelled.LabelValues("game", "GET", "/users"); !reflect.DeepEqual(got, []string{"game", "GET", "/users"}) {
+		t.Errorf("without const label: %v", got)
+	}
+	unlabelled.HTTPRequestDuration.WithLabelValues(unlabelled.LabelValues("game", "GET", "/users", "200")...).Observe(0.1)
+}
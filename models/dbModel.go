@@ -83,7 +83,7 @@ type User struct {
 	ProfilePhotoURL      *string `gorm:"type:text"`
 	ProfilePhotoCachedAt *time.Time
 	Bio                  *string `gorm:"type:text"`
-	WalletAddr           *string `gorm:"type:varchar(255);index:idx_users_wallet_addr"`
+	WalletAddr           *string `gorm:"type:varchar(255);uniqueIndex:idx_users_wallet_addr_unique,where:wallet_addr IS NOT NULL"`
 	WalletConnectedAt    *time.Time
 	WalletType           *string    `gorm:"type:varchar(20)"`
 	WalletSignature      *string    `gorm:"type:text"`
@@ -736,10 +736,27 @@ type ServiceHealthHistory struct {
 
 func (ServiceHealthHistory) TableName() string { return "service_health_history" }
 
+type ServiceRoute struct {
+	ID          uint      `gorm:"primarykey"`
+	ServiceKey  string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_service_routes_key"`
+	UpstreamURL string    `gorm:"type:varchar(255);not null"`
+	CreatedAt   time.Time `gorm:"not null;default:now()"`
+	UpdatedAt   time.Time `gorm:"not null;default:now()"`
+}
+
+func (ServiceRoute) TableName() string { return "service_routes" }
+
 // ============================================
 // AUDIT & SECURITY
 // ============================================
 
+// AuditLog.ActorType values; staff actions record the actor's role name
+const (
+	ActorTypeUser    = "user"
+	ActorTypeService = "service"
+	ActorTypeSystem  = "system"
+)
+
 type AuditLog struct {
 	ID        uint64  `gorm:"primarykey"`
 	Entity    string  `gorm:"type:varchar(50);not null;index:idx_audit_entity"`
@@ -773,6 +790,68 @@ type SecurityEvent struct {
 
 func (SecurityEvent) TableName() string { return "security_events" }
 
+// ============================================
+// ACCESS CONTROL
+// ============================================
+
+type Permission struct {
+	ID          uint      `gorm:"primarykey"`
+	Code        string    `gorm:"type:varchar(100);not null;unique"`
+	Description *string   `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"not null;default:now()"`
+}
+
+func (Permission) TableName() string { return "permissions" }
+
+type Role struct {
+	ID          uint         `gorm:"primarykey"`
+	Name        string       `gorm:"type:varchar(50);not null;unique"`
+	Description *string      `gorm:"type:text"`
+	Rank        int          `gorm:"default:0"` // higher outranks lower in audit logs
+	IsSystem    bool         `gorm:"default:false"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `gorm:"not null;default:now()"`
+	UpdatedAt   time.Time    `gorm:"not null;default:now()"`
+}
+
+func (Role) TableName() string { return "roles" }
+
+type UserRole struct {
+	UserID    uint64    `gorm:"primaryKey;index:idx_user_roles_user"`
+	User      User      `gorm:"foreignKey:UserID"`
+	RoleID    uint      `gorm:"primaryKey"`
+	Role      Role      `gorm:"foreignKey:RoleID"`
+	GrantedBy *uint64   // Nullable Foreign key
+	CreatedAt time.Time `gorm:"not null;default:now()"`
+}
+
+func (UserRole) TableName() string { return "user_roles" }
+
+// ============================================
+// FEATURE FLAGS
+// ============================================
+
+// FeatureFlag gates a feature per user. A disabled flag is off for
+// everyone; otherwise allowlisted users always get it and the rest
+// must match the targeting fields and fall into RolloutPercent.
+type FeatureFlag struct {
+	ID               uint           `gorm:"primarykey"`
+	Key              string         `gorm:"type:varchar(100);not null;unique"`
+	Description      *string        `gorm:"type:text"`
+	Enabled          bool           `gorm:"default:false"`
+	RolloutPercent   int            `gorm:"not null;default:0;check:chk_feature_flags_rollout,rollout_percent BETWEEN 0 AND 100"`
+	AllowUserIDs     datatypes.JSON // []uint64
+	LanguageCodes    datatypes.JSON // []string, empty matches all
+	PremiumOnly      *bool          // nil matches all, false targets non-premium users
+	MinClientVersion *string        `gorm:"type:varchar(20)"`
+	MaxClientVersion *string        `gorm:"type:varchar(20)"`
+	UpdatedBy        *uint64        // Nullable Foreign key
+	CreatedAt        time.Time      `gorm:"not null;default:now()"`
+	UpdatedAt        time.Time      `gorm:"not null;default:now()"`
+}
+
+func (FeatureFlag) TableName() string { return "feature_flags" }
+
 // ============================================
 // MONITORING & METRICS
 // ============================================
@@ -11,10 +11,11 @@ import (
 )
 
 type Cache struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func New(client *redis.Client) *Cache {
+// New accepts any go-redis client, including *pkg/redis.Client
+func New(client redis.UniversalClient) *Cache {
 	return &Cache{client: client}
 }
 
@@ -59,6 +60,15 @@ func (c *Cache) GetOrSet(
 	return nil
 }
 
+// Get reads key into dest; a miss returns redis.Nil
+func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
 // Set with immediate return (Write-Through)
 func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	data, err := json.Marshal(value)
@@ -69,25 +79,51 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time
 	return c.client.Set(ctx, key, data, ttl).Err()
 }
 
-// Delete from cache
+// Delete from cache. Keys are deleted one command each in a pipeline:
+// a multi-key DEL fails with CROSSSLOT in cluster mode unless every key
+// hashes to the same slot.
 func (c *Cache) Delete(ctx context.Context, keys ...string) error {
 	if len(keys) == 0 {
 		return nil
 	}
-	return c.client.Del(ctx, keys...).Err()
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
 }
 
-// Multi-key get
+// Multi-key get, pipelined per key like Delete
 func (c *Cache) MGet(ctx context.Context, keys []string, dest interface{}) error {
 	if len(keys) == 0 {
 		return nil
 	}
 
-	results, err := c.client.MGet(ctx, keys...).Result()
-	if err != nil {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
 		return err
 	}
 
+	results := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return err
+		default:
+			results[i] = val
+		}
+	}
+
 	// Filter non-nil results
 	validResults := make([]interface{}, 0, len(results))
 	for _, r := range results {
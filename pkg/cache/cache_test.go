@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// crossSlotHook fails multi-key commands whose keys carry different
+// hash tags, like Redis Cluster does for keys in different slots
+type crossSlotHook struct{}
+
+func (crossSlotHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (crossSlotHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := checkSlots(cmd); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (crossSlotHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := checkSlots(cmd); err != nil {
+				cmd.SetErr(err)
+				return err
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func checkSlots(cmd redis.Cmder) error {
+	switch cmd.Name() {
+	case "del", "mget", "unlink", "exists":
+	default:
+		return nil
+	}
+	args := cmd.Args()[1:]
+	for _, arg := range args[1:] {
+		if hashTag(arg.(string)) != hashTag(args[0].(string)) {
+			return errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	return nil
+}
+
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	client.AddHook(crossSlotHook{})
+	t.Cleanup(func() { _ = client.Close() })
+	return New(client), srv
+}
+
+func TestDeleteAcrossSlots(t *testing.T) {
+	c, srv := newTestCache(t)
+	keys := []string{"user:1", "user:2", "wallet:{42}:balance"}
+	for _, key := range keys {
+		_ = srv.Set(key, "{}")
+	}
+	_ = srv.Set("user:3", "{}")
+
+	if err := c.Delete(context.Background(), keys...); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if srv.Exists(key) {
+			t.Errorf("%s was not deleted", key)
+		}
+	}
+	if !srv.Exists("user:3") {
+		t.Error("unrelated key deleted")
+	}
+}
+
+func TestMGetAcrossSlots(t *testing.T) {
+	c, srv := newTestCache(t)
+	_ = srv.Set("user:1", "alice")
+	_ = srv.Set("user:3", "carol")
+
+	var got []string
+	if err := c.MGet(context.Background(), []string{"user:1", "user:2", "user:3"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "alice" || got[1] != "carol" {
+		t.Errorf("MGet = %q, want the two cached values", got)
+	}
+
+	if err := c.MGet(context.Background(), []string{"user:8", "user:9"}, &got); !errors.Is(err, redis.Nil) {
+		t.Errorf("MGet of missing keys: got %v, want redis.Nil", err)
+	}
+}
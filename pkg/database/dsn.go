@@ -0,0 +1,66 @@
+// pkg/database/dsn.go
+package database
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/walletYabPangu/shared/config"
+)
+
+// DSN builds a postgres:// URL for the primary. User, password and every
+// parameter are escaped, so any character is allowed in them.
+func DSN(cfg config.DbConfig) string {
+	return dsnForHost(cfg, net.JoinHostPort(cfg.Host, strconv.FormatInt(cfg.Port, 10)))
+}
+
+// ReplicaDSNs builds one URL per POSTGRES_REPLICA_HOSTS entry. Hosts
+// without a port use the primary's port.
+func ReplicaDSNs(cfg config.DbConfig) []string {
+	out := make([]string, 0, len(cfg.ReplicaHosts))
+	for _, host := range cfg.ReplicaHosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.FormatInt(cfg.Port, 10))
+		}
+		out = append(out, dsnForHost(cfg, host))
+	}
+	return out
+}
+
+func dsnForHost(cfg config.DbConfig, hostPort string) string {
+	q := url.Values{}
+	q.Set("sslmode", cfg.SSLMode)
+	if q.Get("sslmode") == "" {
+		q.Set("sslmode", "disable")
+	}
+	setIf(q, "sslrootcert", cfg.SSLRootCert)
+	setIf(q, "sslcert", cfg.SSLCert)
+	setIf(q, "sslkey", cfg.SSLKey)
+	setIf(q, "application_name", cfg.ApplicationName)
+	setIf(q, "search_path", cfg.SearchPath)
+	setIf(q, "TimeZone", cfg.TimeZone)
+	if cfg.ConnectTimeout > 0 {
+		// libpq only accepts whole seconds; round up so 500ms isn't "no timeout"
+		q.Set("connect_timeout", strconv.FormatInt(int64((cfg.ConnectTimeout+time.Second-1)/time.Second), 10))
+	}
+	if cfg.StatementTimeout > 0 {
+		q.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     hostPort,
+		Path:     "/" + cfg.DBName,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+func setIf(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/walletYabPangu/shared/config"
+)
+
+// The driver must read back exactly the configured credentials, however
+// many URL delimiters they contain
+func TestDSNEscapesCredentials(t *testing.T) {
+	passwords := []string{
+		"plain",
+		"p@ss:w/rd?x=1%20#frag",
+		"with spaces and %",
+		"@:/?%",
+	}
+	for _, password := range passwords {
+		cfg := config.DbConfig{
+			Host:     "db.internal",
+			Port:     5432,
+			User:     "app user@corp",
+			Password: password,
+			DBName:   "wallet",
+			SSLMode:  "require",
+		}
+
+		pc, err := pgconn.ParseConfig(DSN(cfg))
+		if err != nil {
+			t.Fatalf("password %q: %v", password, err)
+		}
+		if pc.Password != password || pc.User != cfg.User || pc.Database != "wallet" {
+			t.Errorf("password %q: parsed user %q, password %q, db %q", password, pc.User, pc.Password, pc.Database)
+		}
+		if pc.Host != "db.internal" || pc.Port != 5432 {
+			t.Errorf("password %q: parsed host %s:%d", password, pc.Host, pc.Port)
+		}
+	}
+}
+
+func TestDSNParameters(t *testing.T) {
+	cfg := config.DbConfig{
+		Host:             "db.internal",
+		Port:             5432,
+		User:             "app",
+		Password:         "secret",
+		DBName:           "wallet",
+		ApplicationName:  "auth service",
+		SearchPath:       "app,public",
+		ConnectTimeout:   1500 * time.Millisecond,
+		StatementTimeout: 30 * time.Second,
+	}
+
+	pc, err := pgconn.ParseConfig(DSN(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"application_name":  "auth service",
+		"search_path":       "app,public",
+		"statement_timeout": "30000",
+	}
+	for k, v := range want {
+		if got := pc.RuntimeParams[k]; got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	// rounded up to whole seconds
+	if pc.ConnectTimeout != 2*time.Second {
+		t.Errorf("connect timeout = %s, want 2s", pc.ConnectTimeout)
+	}
+	if pc.TLSConfig != nil {
+		t.Error("sslmode defaulted to something other than disable")
+	}
+}
+
+func TestReplicaDSNs(t *testing.T) {
+	cfg := config.DbConfig{
+		Port:         5432,
+		User:         "app",
+		Password:     "p@ss:w/rd? %",
+		DBName:       "wallet",
+		ReplicaHosts: []string{"replica-1", "replica-2:6432", "::1", "[::1]:6433"},
+	}
+	want := []struct {
+		host string
+		port uint16
+	}{
+		{"replica-1", 5432},
+		{"replica-2", 6432},
+		{"::1", 5432},
+		{"::1", 6433},
+	}
+
+	dsns := ReplicaDSNs(cfg)
+	if len(dsns) != len(want) {
+		t.Fatalf("got %d DSNs, want %d", len(dsns), len(want))
+	}
+	for i, dsn := range dsns {
+		pc, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", cfg.ReplicaHosts[i], err)
+		}
+		if pc.Host != want[i].host || pc.Port != want[i].port || pc.Password != cfg.Password {
+			t.Errorf("%s: parsed %s:%d password %q", cfg.ReplicaHosts[i], pc.Host, pc.Port, pc.Password)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// pkg/database/gorm-logger.go
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/walletYabPangu/shared/config"
+	"github.com/walletYabPangu/shared/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+var _ gorm.ParamsFilter = (*GormLogger)(nil)
+
+// GormLoggerConfig configures GormLogger
+type GormLoggerConfig struct {
+	LogLevel                  gormlogger.LogLevel
+	SlowThreshold             time.Duration
+	IgnoreRecordNotFoundError bool
+
+	// Regular queries are sampled per statement shape (literals
+	// stripped): the first SampleInitial per SampleTick are logged, then
+	// every SampleThereafter-th. SampleInitial 0 logs every query.
+	SampleInitial    int
+	SampleThereafter int
+	SampleTick       time.Duration
+}
+
+// GormLogger is a gorm logger.Interface writing structured entries to
+// a pkg/logger.Logger. Errors and slow queries are always logged;
+// other queries at debug level, sampled. Statements are logged with
+// placeholders; bound values, which often hold personal data, only
+// when the gorm module logs at debug, and then redacted like any entry.
+type GormLogger struct {
+	log     *logger.Logger
+	cfg     GormLoggerConfig
+	sampler *statementSampler
+}
+
+func NewGormLogger(l *logger.Logger, cfg GormLoggerConfig) *GormLogger {
+	if cfg.SampleTick <= 0 {
+		cfg.SampleTick = time.Second
+	}
+	// "caller" is set to the application code issuing the query; zap's
+	// caller and stack traces would only point into this adapter
+	l = l.Module("gorm").WithOptions(zap.WithCaller(false), zap.AddStacktrace(zap.FatalLevel))
+	return &GormLogger{
+		log:     l,
+		cfg:     cfg,
+		sampler: newStatementSampler(cfg.SampleInitial, cfg.SampleThereafter, cfg.SampleTick),
+	}
+}
+
+// GormLoggerConfigFrom reads the POSTGRES_LOG* settings of cfg
+func GormLoggerConfigFrom(cfg config.DbConfig) GormLoggerConfig {
+	var level gormlogger.LogLevel
+	switch cfg.LogLevel {
+	case "silent":
+		level = gormlogger.Silent
+	case "error":
+		level = gormlogger.Error
+	case "warn":
+		level = gormlogger.Warn
+	default:
+		level = gormlogger.Info
+	}
+
+	return GormLoggerConfig{
+		LogLevel:                  level,
+		SlowThreshold:             cfg.SlowThreshold,
+		IgnoreRecordNotFoundError: true,
+		SampleInitial:             cfg.LogSampleInitial,
+		SampleThereafter:          cfg.LogSampleThereafter,
+	}
+}
+
+// LogMode returns a copy logging at level; the sampler is shared
+func (g *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *g
+	clone.cfg.LogLevel = level
+	return &clone
+}
+
+func (g *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if g.cfg.LogLevel >= gormlogger.Info {
+		g.log.WithContext(ctx).Infow(fmt.Sprintf(msg, data...), "caller", utils.FileWithLineNum())
+	}
+}
+
+func (g *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if g.cfg.LogLevel >= gormlogger.Warn {
+		g.log.WithContext(ctx).Warnw(fmt.Sprintf(msg, data...), "caller", utils.FileWithLineNum())
+	}
+}
+
+func (g *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if g.cfg.LogLevel >= gormlogger.Error {
+		g.log.WithContext(ctx).Errorw(fmt.Sprintf(msg, data...), "caller", utils.FileWithLineNum())
+	}
+}
+
+// ParamsFilter drops the bound values from logged statements unless
+// debug is enabled. gorm calls it from the function passed to Trace.
+func (g *GormLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if g.log.Desugar().Core().Enabled(zap.DebugLevel) {
+		return sql, params
+	}
+	return sql, nil
+}
+
+// Trace logs one executed statement
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if g.cfg.LogLevel <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	isErr := err != nil && !(g.cfg.IgnoreRecordNotFoundError && errors.Is(err, gorm.ErrRecordNotFound))
+	isSlow := g.cfg.SlowThreshold > 0 && elapsed > g.cfg.SlowThreshold
+
+	switch {
+	case isErr && g.cfg.LogLevel >= gormlogger.Error:
+	case isSlow && g.cfg.LogLevel >= gormlogger.Warn:
+	case g.cfg.LogLevel >= gormlogger.Info && g.log.Desugar().Core().Enabled(zap.DebugLevel):
+	default:
+		return
+	}
+
+	sql, rows := fc()
+	if !isErr && !isSlow && !g.sampler.allow(sql) {
+		return
+	}
+
+	fields := []interface{}{
+		"sql", sql,
+		"duration_ms", float64(elapsed.Microseconds()) / 1000,
+		"caller", utils.FileWithLineNum(),
+	}
+	if rows >= 0 {
+		fields = append(fields, "rows", rows)
+	}
+
+	log := g.log.WithContext(ctx)
+	switch {
+	case isErr:
+		log.Errorw("query failed", append(fields, "error", err)...)
+	case isSlow:
+		log.Warnw("slow query", append(fields, "threshold_ms", g.cfg.SlowThreshold.Milliseconds())...)
+	default:
+		log.Debugw("query", fields...)
+	}
+}
+
+// statementSampler limits repeated statements per tick, like zap's
+// sampler but keyed by the statement with its literals removed
+type statementSampler struct {
+	initial, thereafter int
+	tick                time.Duration
+
+	mu     sync.Mutex
+	window time.Time
+	counts map[uint64]int
+}
+
+func newStatementSampler(initial, thereafter int, tick time.Duration) *statementSampler {
+	return &statementSampler{
+		initial:    initial,
+		thereafter: thereafter,
+		tick:       tick,
+		counts:     make(map[uint64]int),
+	}
+}
+
+var sqlLiterals = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+
+func (s *statementSampler) allow(sql string) bool {
+	if s.initial <= 0 {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(sqlLiterals.ReplaceAllString(sql, "?")))
+	key := h.Sum64()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.window) >= s.tick {
+		s.window = now
+		clear(s.counts)
+	}
+
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
@@ -2,50 +2,41 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"github.com/walletYabPangu/shared/config"
-	"log"
-	"os"
+	"github.com/walletYabPangu/shared/pkg/logger"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
-func NewGORM(cfg config.DbConfig) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable TimeZone=UTC",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName,
-	)
-
-	// Configure logger
-	var logLevel logger.LogLevel
-	switch cfg.LogLevel {
-	case "silent":
-		logLevel = logger.Silent
-	case "error":
-		logLevel = logger.Error
-	case "warn":
-		logLevel = logger.Warn
-	case "info":
-		logLevel = logger.Info
-	default:
-		logLevel = logger.Info
+type options struct {
+	logger *logger.Logger
+}
+
+type Option func(*options)
+
+// WithLogger sends GORM logs to l, under the module "gorm"; without
+// it a production JSON logger is used
+func WithLogger(l *logger.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+func NewGORM(cfg config.DbConfig, opts ...Option) (*gorm.DB, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		// Falls back to stderr JSON on error, which is what we want here
+		o.logger, _ = logger.New("production")
 	}
-	//logLevel = logger.Info
-
-	gormLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold:             200 * time.Millisecond,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  true,
-		},
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	gormLogger := NewGormLogger(o.logger, GormLoggerConfigFrom(cfg))
+
+	db, err := gorm.Open(postgres.Open(DSN(cfg)), &gorm.Config{
 		Logger:                 gormLogger,
 		SkipDefaultTransaction: true, // Better performance
 		PrepareStmt:            true, // Cache prepared statements
@@ -54,17 +45,79 @@ func NewGORM(cfg config.DbConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	// Get generic database object to configure connection pool
+	// Reads go to a random replica, writes and transactions to the primary
+	if replicas := ReplicaDSNs(cfg); len(replicas) > 0 {
+		dialectors := make([]gorm.Dialector, len(replicas))
+		for i, dsn := range replicas {
+			dialectors[i] = postgres.Open(dsn)
+		}
+		if err := db.Use(dbresolver.Register(dbresolver.Config{
+			Replicas: dialectors,
+			Policy:   dbresolver.RandomPolicy{},
+		})); err != nil {
+			_ = Close(db)
+			return nil, fmt.Errorf("failed to register replicas: %w", err)
+		}
+	}
+
+	// Configure connection pool
+	if err := ApplyPoolSettings(db, cfg); err != nil {
+		_ = Close(db)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Close releases the replica pools registered by NewGORM and the
+// primary pool; db.DB().Close() alone leaves the replicas open
+func Close(db *gorm.DB) error {
+	var errs []error
+	if plugin, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]; ok {
+		if resolver, ok := plugin.(*dbresolver.DBResolver); ok {
+			_ = resolver.Call(func(pool gorm.ConnPool) error {
+				// the primary appears here too; sql.DB.Close is idempotent
+				if c, ok := pool.(interface{ Close() error }); ok {
+					if err := c.Close(); err != nil {
+						errs = append(errs, err)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if err := sqlDB.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ApplyPoolSettings (re)applies the connection pool limits of cfg.
+// It is safe on a live pool, e.g. from a config.Subscribe callback.
+func ApplyPoolSettings(db *gorm.DB, cfg config.DbConfig) error {
 	sqlDB, err := db.DB()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get db: %w", err)
+		return fmt.Errorf("failed to get db: %w", err)
 	}
 
 	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Minute)
 
-	return db, nil
+	// Replica pools get the same limits
+	if plugin, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]; ok {
+		if resolver, ok := plugin.(*dbresolver.DBResolver); ok {
+			resolver.SetMaxIdleConns(cfg.MaxIdleConns).
+				SetMaxOpenConns(cfg.MaxOpenConns).
+				SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Minute)
+		}
+	}
+	return nil
 }
 
 // Transaction helper
@@ -0,0 +1,315 @@
+// pkg/featureflag/featureflag.go
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/cache"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidFlag = errors.New("featureflag: invalid flag")
+
+const (
+	flagsCacheKey   = "featureflag:flags:"
+	flagsVersionKey = "featureflag:version"
+	flagsTTL        = time.Minute
+)
+
+// Subject is who a flag is evaluated for
+type Subject struct {
+	UserID        uint64
+	LanguageCode  string
+	IsPremium     bool
+	ClientVersion string // e.g. "1.4.2", empty when unknown
+}
+
+// SubjectFromUser builds a Subject; the client version comes from the
+// request since it isn't stored on the user.
+func SubjectFromUser(u *models.User, clientVersion string) Subject {
+	return Subject{
+		UserID:        u.ID,
+		LanguageCode:  u.LanguageCode,
+		IsPremium:     u.IsPremium,
+		ClientVersion: clientVersion,
+	}
+}
+
+// rule is the decoded form of a FeatureFlag, as stored in the cache
+type rule struct {
+	Enabled          bool            `json:"enabled"`
+	RolloutPercent   int             `json:"rollout_percent"`
+	AllowUserIDs     map[uint64]bool `json:"allow_user_ids,omitempty"`
+	LanguageCodes    []string        `json:"language_codes,omitempty"`
+	PremiumOnly      *bool           `json:"premium_only,omitempty"`
+	MinClientVersion string          `json:"min_client_version,omitempty"`
+	MaxClientVersion string          `json:"max_client_version,omitempty"`
+}
+
+func compile(f models.FeatureFlag) (rule, error) {
+	r := rule{
+		Enabled:        f.Enabled,
+		RolloutPercent: f.RolloutPercent,
+		PremiumOnly:    f.PremiumOnly,
+	}
+	if f.MinClientVersion != nil {
+		r.MinClientVersion = *f.MinClientVersion
+	}
+	if f.MaxClientVersion != nil {
+		r.MaxClientVersion = *f.MaxClientVersion
+	}
+
+	if len(f.AllowUserIDs) > 0 {
+		var ids []uint64
+		if err := json.Unmarshal(f.AllowUserIDs, &ids); err != nil {
+			return r, fmt.Errorf("%w: %s: allow_user_ids: %v", ErrInvalidFlag, f.Key, err)
+		}
+		r.AllowUserIDs = make(map[uint64]bool, len(ids))
+		for _, id := range ids {
+			r.AllowUserIDs[id] = true
+		}
+	}
+	if len(f.LanguageCodes) > 0 {
+		if err := json.Unmarshal(f.LanguageCodes, &r.LanguageCodes); err != nil {
+			return r, fmt.Errorf("%w: %s: language_codes: %v", ErrInvalidFlag, f.Key, err)
+		}
+	}
+
+	if r.RolloutPercent < 0 || r.RolloutPercent > 100 {
+		return r, fmt.Errorf("%w: %s: rollout percent %d out of 0-100", ErrInvalidFlag, f.Key, r.RolloutPercent)
+	}
+	for _, v := range []string{r.MinClientVersion, r.MaxClientVersion} {
+		if _, ok := parseVersion(v); v != "" && !ok {
+			return r, fmt.Errorf("%w: %s: bad client version %q", ErrInvalidFlag, f.Key, v)
+		}
+	}
+	return r, nil
+}
+
+func (r rule) enabledFor(key string, s Subject) bool {
+	if !r.Enabled {
+		return false
+	}
+	if r.AllowUserIDs[s.UserID] {
+		return true
+	}
+
+	if len(r.LanguageCodes) > 0 && !containsFold(r.LanguageCodes, s.LanguageCode) {
+		return false
+	}
+	if r.PremiumOnly != nil && *r.PremiumOnly != s.IsPremium {
+		return false
+	}
+	if r.MinClientVersion != "" || r.MaxClientVersion != "" {
+		v, ok := parseVersion(s.ClientVersion)
+		if !ok {
+			return false
+		}
+		if min, _ := parseVersion(r.MinClientVersion); r.MinClientVersion != "" && compareVersions(v, min) < 0 {
+			return false
+		}
+		if max, _ := parseVersion(r.MaxClientVersion); r.MaxClientVersion != "" && compareVersions(v, max) > 0 {
+			return false
+		}
+	}
+
+	return Bucket(key, s.UserID) < r.RolloutPercent
+}
+
+// Bucket places a user in 0-99 for a flag. It is stable, so raising
+// the rollout only adds users, and salted with the key so different
+// flags roll out to different users first.
+func Bucket(key string, userID uint64) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte{':'})
+	h.Write([]byte(strconv.FormatUint(userID, 10)))
+	return int(h.Sum32() % 100)
+}
+
+type Evaluator struct {
+	db    *gorm.DB
+	cache *cache.Cache
+	// load reads the flags table; replaced in tests
+	load func(ctx context.Context) (map[string]rule, error)
+}
+
+// New creates an Evaluator. Flags are cached through c when it is not
+// nil; Save and Delete invalidate the cache.
+func New(db *gorm.DB, c *cache.Cache) *Evaluator {
+	e := &Evaluator{db: db, cache: c}
+	e.load = e.loadRules
+	return e
+}
+
+// Migrate creates the feature_flags table
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.FeatureFlag{})
+}
+
+func (e *Evaluator) loadRules(ctx context.Context) (map[string]rule, error) {
+	var flags []models.FeatureFlag
+	if err := e.db.WithContext(ctx).Find(&flags).Error; err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]rule, len(flags))
+	for _, f := range flags {
+		r, err := compile(f)
+		if err != nil {
+			// A broken flag is off rather than failing every other flag
+			continue
+		}
+		rules[f.Key] = r
+	}
+	return rules, nil
+}
+
+// rules are cached under the current version, which Invalidate bumps.
+// A load that read the table before a change can only fill the old
+// version's key, so it never hides the change.
+func (e *Evaluator) rules(ctx context.Context) (map[string]rule, error) {
+	if e.cache == nil {
+		return e.load(ctx)
+	}
+
+	var version int64
+	if err := e.cache.Get(ctx, flagsVersionKey, &version); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	key := flagsCacheKey + strconv.FormatInt(version, 10)
+
+	var rules map[string]rule
+	if err := e.cache.Get(ctx, key, &rules); err == nil {
+		return rules, nil
+	}
+
+	rules, err := e.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A failed write only costs another load
+	_ = e.cache.Set(ctx, key, rules, flagsTTL)
+	return rules, nil
+}
+
+// IsEnabled reports whether flag key is on for s. Unknown flags are off.
+func (e *Evaluator) IsEnabled(ctx context.Context, key string, s Subject) (bool, error) {
+	rules, err := e.rules(ctx)
+	if err != nil {
+		return false, err
+	}
+	r, ok := rules[key]
+	return ok && r.enabledFor(key, s), nil
+}
+
+// Evaluate returns every flag for s, e.g. to send to the Mini App on start
+func (e *Evaluator) Evaluate(ctx context.Context, s Subject) (map[string]bool, error) {
+	rules, err := e.rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]bool, len(rules))
+	for key, r := range rules {
+		out[key] = r.enabledFor(key, s)
+	}
+	return out, nil
+}
+
+// Save creates or updates a flag by key and invalidates the cache
+func (e *Evaluator) Save(ctx context.Context, flag *models.FeatureFlag) error {
+	if flag.Key == "" {
+		return fmt.Errorf("%w: key is required", ErrInvalidFlag)
+	}
+	if _, err := compile(*flag); err != nil {
+		return err
+	}
+
+	err := e.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"description", "enabled", "rollout_percent", "allow_user_ids", "language_codes",
+			"premium_only", "min_client_version", "max_client_version", "updated_by", "updated_at",
+		}),
+	}).Create(flag).Error
+	if err != nil {
+		return err
+	}
+	return e.Invalidate(ctx)
+}
+
+// Delete removes a flag and invalidates the cache
+func (e *Evaluator) Delete(ctx context.Context, key string) error {
+	if err := e.db.WithContext(ctx).Where("key = ?", key).Delete(&models.FeatureFlag{}).Error; err != nil {
+		return err
+	}
+	return e.Invalidate(ctx)
+}
+
+// Invalidate moves readers to a new cache version; call it after
+// editing the table directly
+func (e *Evaluator) Invalidate(ctx context.Context) error {
+	if e.cache == nil {
+		return nil
+	}
+	_, err := e.cache.Incr(ctx, flagsVersionKey)
+	return err
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersion reads "1.2.3" or "v1.2"; missing parts count as 0
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return v, false
+	}
+	// Ignore pre-release and build suffixes
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
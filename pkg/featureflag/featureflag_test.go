@@ -0,0 +1,192 @@
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/cache"
+)
+
+// Buckets are FNV-1a of "<key>:<user id>" mod 100 and must never
+// change, or a deploy would reshuffle every running rollout
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		key    string
+		userID uint64
+		want   int
+	}{
+		{"new_shop", 1, 3},
+		{"new_shop", 42, 30},
+		{"new_shop", 1000, 9},
+		{"new_shop", 123456789, 43},
+		{"game_v2", 1, 13},
+		{"game_v2", 42, 4},
+		{"game_v2", 1000, 55},
+		{"game_v2", 123456789, 97},
+	}
+	for _, tt := range tests {
+		if got := Bucket(tt.key, tt.userID); got != tt.want {
+			t.Errorf("Bucket(%q, %d) = %d, want %d", tt.key, tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestRolloutBuckets(t *testing.T) {
+	const users = 10000
+	tests := []struct {
+		percent  int
+		min, max int // users enabled
+	}{
+		{0, 0, 0},
+		{1, 50, 150},
+		{10, 900, 1100},
+		{50, 4800, 5200},
+		{99, 9850, 9950},
+		{100, users, users},
+	}
+
+	prev := map[uint64]bool{}
+	for _, tt := range tests {
+		r := rule{Enabled: true, RolloutPercent: tt.percent}
+		enabled := map[uint64]bool{}
+		for id := uint64(1); id <= users; id++ {
+			if r.enabledFor("new_shop", Subject{UserID: id}) {
+				enabled[id] = true
+			}
+		}
+		if n := len(enabled); n < tt.min || n > tt.max {
+			t.Errorf("%d%% enabled %d users, want %d-%d", tt.percent, n, tt.min, tt.max)
+		}
+		// Raising the rollout only adds users
+		for id := range prev {
+			if !enabled[id] {
+				t.Errorf("user %d lost the flag going to %d%%", id, tt.percent)
+			}
+		}
+		prev = enabled
+	}
+}
+
+func TestCompileRolloutPercent(t *testing.T) {
+	tests := []struct {
+		percent int
+		ok      bool
+	}{
+		{-1, false},
+		{0, true},
+		{100, true},
+		{101, false},
+	}
+	for _, tt := range tests {
+		_, err := compile(models.FeatureFlag{Key: "new_shop", RolloutPercent: tt.percent})
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("rollout %d: err = %v", tt.percent, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidFlag) {
+			t.Errorf("rollout %d: err = %v, want ErrInvalidFlag", tt.percent, err)
+		}
+	}
+}
+
+func TestClientVersionTargeting(t *testing.T) {
+	r := rule{Enabled: true, RolloutPercent: 100, MinClientVersion: "1.4", MaxClientVersion: "2.0.0"}
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"", false},
+		{"garbage", false},
+		{"1.3.9", false},
+		{"1.4", true},
+		{"v1.4.0-beta", true},
+		{"2.0.0", true},
+		{"2.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := r.enabledFor("new_shop", Subject{UserID: 1, ClientVersion: tt.version}); got != tt.want {
+			t.Errorf("version %q: enabled = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+// newTestEvaluator caches through miniredis and loads *flags instead
+// of the database, counting loads
+func newTestEvaluator(t *testing.T, flags *map[string]rule) (*Evaluator, *miniredis.Miniredis, *int) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	loads := 0
+	e := New(nil, cache.New(client))
+	e.load = func(context.Context) (map[string]rule, error) {
+		loads++
+		return *flags, nil
+	}
+	return e, srv, &loads
+}
+
+func TestInvalidateBumpsVersion(t *testing.T) {
+	ctx := context.Background()
+	flags := map[string]rule{"new_shop": {Enabled: false}}
+	e, srv, loads := newTestEvaluator(t, &flags)
+	user := Subject{UserID: 42}
+
+	for i := 0; i < 2; i++ {
+		if on, err := e.IsEnabled(ctx, "new_shop", user); err != nil || on {
+			t.Fatalf("IsEnabled = %v, %v; want off", on, err)
+		}
+	}
+	if *loads != 1 {
+		t.Fatalf("loaded %d times, want a cached second read", *loads)
+	}
+
+	flags = map[string]rule{"new_shop": {Enabled: true, RolloutPercent: 100}}
+	if on, _ := e.IsEnabled(ctx, "new_shop", user); on {
+		t.Fatal("cached flags changed without Invalidate")
+	}
+	if err := e.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := srv.Get(flagsVersionKey); v != "1" {
+		t.Fatalf("version = %q, want 1", v)
+	}
+	if on, err := e.IsEnabled(ctx, "new_shop", user); err != nil || !on {
+		t.Fatalf("IsEnabled = %v, %v after Invalidate; want on", on, err)
+	}
+	if *loads != 2 {
+		t.Fatalf("loaded %d times, want 2", *loads)
+	}
+}
+
+// A reader that loaded the table just before a change must not cache
+// the old flags over the invalidation
+func TestStaleLoadDoesNotHideChange(t *testing.T) {
+	ctx := context.Background()
+	flags := map[string]rule{"new_shop": {Enabled: false}}
+	e, _, _ := newTestEvaluator(t, &flags)
+	user := Subject{UserID: 42}
+
+	load := e.load
+	e.load = func(ctx context.Context) (map[string]rule, error) {
+		old, err := load(ctx)
+		// Save commits and invalidates while this load is in flight
+		flags = map[string]rule{"new_shop": {Enabled: true, RolloutPercent: 100}}
+		if err := e.Invalidate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		e.load = load
+		return old, err
+	}
+
+	if on, _ := e.IsEnabled(ctx, "new_shop", user); on {
+		t.Fatal("in-flight load returned the new flags")
+	}
+	if on, err := e.IsEnabled(ctx, "new_shop", user); err != nil || !on {
+		t.Fatalf("IsEnabled = %v, %v; the stale load hid the change", on, err)
+	}
+}
@@ -0,0 +1,204 @@
+// pkg/logger/level.go
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels holds the base level and per-module overrides of a logger
+// and everything derived from it. They can be changed at runtime.
+type Levels struct {
+	base zap.AtomicLevel
+
+	mu      sync.RWMutex
+	modules map[string]zapcore.Level
+}
+
+func newLevels(base zapcore.Level) *Levels {
+	return &Levels{base: zap.NewAtomicLevelAt(base), modules: map[string]zapcore.Level{}}
+}
+
+// Enabled reports whether module logs at lvl; "" is the base level
+func (lv *Levels) Enabled(module string, lvl zapcore.Level) bool {
+	if module != "" {
+		lv.mu.RLock()
+		override, ok := lv.modules[module]
+		lv.mu.RUnlock()
+		if ok {
+			return override.Enabled(lvl)
+		}
+	}
+	return lv.base.Enabled(lvl)
+}
+
+// Base is the level used by modules without an override
+func (lv *Levels) Base() zap.AtomicLevel {
+	return lv.base
+}
+
+func (lv *Levels) SetLevel(level string) error {
+	l, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	lv.base.SetLevel(l)
+	return nil
+}
+
+// SetModule overrides the level of module; an empty level removes the
+// override
+func (lv *Levels) SetModule(module, level string) error {
+	if level == "" {
+		lv.mu.Lock()
+		delete(lv.modules, module)
+		lv.mu.Unlock()
+		return nil
+	}
+
+	l, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("module %s: %w", module, err)
+	}
+	lv.mu.Lock()
+	lv.modules[module] = l
+	lv.mu.Unlock()
+	return nil
+}
+
+// SetModules replaces all module overrides
+func (lv *Levels) SetModules(modules map[string]string) error {
+	parsed := make(map[string]zapcore.Level, len(modules))
+	for module, level := range modules {
+		l, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", module, err)
+		}
+		parsed[module] = l
+	}
+
+	lv.mu.Lock()
+	lv.modules = parsed
+	lv.mu.Unlock()
+	return nil
+}
+
+// Modules returns the current overrides
+func (lv *Levels) Modules() map[string]string {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+
+	out := make(map[string]string, len(lv.modules))
+	for module, l := range lv.modules {
+		out[module] = l.String()
+	}
+	return out
+}
+
+type levelsPayload struct {
+	Level   string            `json:"level,omitempty"`
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// ServeHTTP reports the levels on GET and changes them on PUT, e.g.
+//
+//	{"level": "debug", "modules": {"gorm": "info", "tonproof": ""}}
+//
+// Modules listed are set, or removed when empty; others are kept.
+// Mount it on an internal or admin-only route.
+func (lv *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req levelsPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeLevelError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if err := lv.apply(req); err != nil {
+			writeLevelError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeLevelError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(levelsPayload{Level: lv.base.Level().String(), Modules: lv.Modules()})
+}
+
+// ReadOnly serves the levels on GET only, for listeners reachable by
+// more than administrators such as the metrics port
+func (lv *Levels) ReadOnly() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeLevelError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		lv.ServeHTTP(w, r)
+	})
+}
+
+// apply validates every level before changing any
+func (lv *Levels) apply(req levelsPayload) error {
+	if req.Level != "" {
+		if _, err := zapcore.ParseLevel(req.Level); err != nil {
+			return err
+		}
+	}
+	for module, level := range req.Modules {
+		if level == "" {
+			continue
+		}
+		if _, err := zapcore.ParseLevel(level); err != nil {
+			return fmt.Errorf("module %s: %w", module, err)
+		}
+	}
+
+	if req.Level != "" {
+		_ = lv.SetLevel(req.Level)
+	}
+	for module, level := range req.Modules {
+		_ = lv.SetModule(module, level)
+	}
+	return nil
+}
+
+func writeLevelError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// levelCore filters entries by Levels before the wrapped core sees
+// them, so the cores below are built at debug level
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+	module string
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.levels.Enabled(c.module, lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels, module: c.module}
+}
+
+// Check delegates instead of adding itself: zap's sampler below
+// makes its decision in Check
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
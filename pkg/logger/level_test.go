@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/walletYabPangu/shared/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func serveLevels(t *testing.T, h http.Handler, method, body string) (int, levelsPayload, http.Header) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, "/log/level", strings.NewReader(body)))
+
+	var got levelsPayload
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, got, rec.Header()
+}
+
+func TestLevelsServeHTTP(t *testing.T) {
+	lv := newLevels(zapcore.InfoLevel)
+	if err := lv.SetModules(map[string]string{"gorm": "warn", "tonproof": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, got, _ := serveLevels(t, lv, http.MethodGet, "")
+	want := levelsPayload{Level: "info", Modules: map[string]string{"gorm": "warn", "tonproof": "debug"}}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("GET = %d %+v, want %+v", code, got, want)
+	}
+
+	code, got, _ = serveLevels(t, lv, http.MethodPut, `{"level": "debug", "modules": {"gorm": "error", "tonproof": ""}}`)
+	want = levelsPayload{Level: "debug", Modules: map[string]string{"gorm": "error"}}
+	if code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("PUT = %d %+v, want %+v", code, got, want)
+	}
+	if !lv.Enabled("", zapcore.DebugLevel) || lv.Enabled("gorm", zapcore.WarnLevel) || !lv.Enabled("tonproof", zapcore.DebugLevel) {
+		t.Error("PUT did not change the levels")
+	}
+
+	// Nothing is applied when one level is invalid
+	for _, body := range []string{`{"level": "loud"}`, `{"level": "warn", "modules": {"gorm": "loud"}}`, `not json`} {
+		if code, _, _ := serveLevels(t, lv, http.MethodPut, body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, code)
+		}
+	}
+	if _, got, _ := serveLevels(t, lv, http.MethodGet, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("rejected PUT changed the levels: %+v", got)
+	}
+
+	code, _, header := serveLevels(t, lv, http.MethodDelete, "")
+	if code != http.StatusMethodNotAllowed || header.Get("Allow") != "GET, PUT" {
+		t.Errorf("DELETE = %d, Allow %q", code, header.Get("Allow"))
+	}
+}
+
+func TestLevelsReadOnly(t *testing.T) {
+	lv := newLevels(zapcore.InfoLevel)
+	h := lv.ReadOnly()
+
+	if code, got, _ := serveLevels(t, h, http.MethodGet, ""); code != http.StatusOK || got.Level != "info" {
+		t.Errorf("GET = %d %+v", code, got)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodPost} {
+		code, _, header := serveLevels(t, h, method, `{"level": "debug"}`)
+		if code != http.StatusMethodNotAllowed || header.Get("Allow") != "GET" {
+			t.Errorf("%s = %d, Allow %q", method, code, header.Get("Allow"))
+		}
+	}
+	if lv.Enabled("", zapcore.DebugLevel) {
+		t.Error("read-only handler changed the level")
+	}
+}
+
+func TestModuleLevels(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	levels := newLevels(zapcore.InfoLevel)
+	root := &Logger{SugaredLogger: zap.New(&levelCore{Core: obs, levels: levels}).Sugar(), levels: levels}
+	gorm := root.Module("gorm").With("table", "users")
+	other := root.Module("tonproof")
+
+	logged := func() []string {
+		var out []string
+		for _, e := range logs.TakeAll() {
+			out = append(out, e.LoggerName+":"+e.Message)
+		}
+		return out
+	}
+	emit := func() {
+		root.Debug("root debug")
+		root.Info("root info")
+		gorm.Debug("gorm debug")
+		gorm.Info("gorm info")
+		other.Debug("tonproof debug")
+	}
+
+	emit()
+	if got, want := logged(), []string{":root info", "gorm:gorm info"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("base level: %v, want %v", got, want)
+	}
+
+	if err := levels.SetModule("gorm", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	emit()
+	if got, want := logged(), []string{":root info", "gorm:gorm debug", "gorm:gorm info"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gorm at debug: %v, want %v", got, want)
+	}
+
+	if err := levels.SetModule("gorm", "error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := levels.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	emit()
+	if got, want := logged(), []string{":root debug", ":root info", "tonproof:tonproof debug"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gorm at error, base at debug: %v, want %v", got, want)
+	}
+
+	if err := levels.SetModule("gorm", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !gorm.Desugar().Core().Enabled(zapcore.DebugLevel) {
+		t.Error("gorm does not follow the base level after its override is removed")
+	}
+}
+
+func TestLevelsOfForeignLogger(t *testing.T) {
+	l := &Logger{SugaredLogger: zap.NewNop().Sugar()}
+	if _, err := l.Levels(); !errors.Is(err, ErrFixedLevels) {
+		t.Errorf("Levels = %v, want ErrFixedLevels", err)
+	}
+	if err := l.ApplyConfig(config.LogConfig{Level: "debug"}); !errors.Is(err, ErrFixedLevels) {
+		t.Errorf("ApplyConfig = %v, want ErrFixedLevels", err)
+	}
+}
@@ -3,45 +3,287 @@ package logger
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/walletYabPangu/shared/config"
+	"github.com/walletYabPangu/shared/pkg/reqctx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"log/slog"
+	"os"
+	"time"
 )
 
+// ErrFixedLevels is returned by Levels for a Logger built outside New
+var ErrFixedLevels = errors.New("logger: levels are fixed, logger not built by New")
+
 type Logger struct {
 	*zap.SugaredLogger
+	levels *Levels
+}
+
+type options struct {
+	redactor *Redactor
+	level    string
+	modules  map[string]string
+	encoding string
+
+	sampleInitial, sampleThereafter int
+	sampleTick                      time.Duration
+
+	telegram *Telegram
+	slog     slog.Handler
+}
+
+type Option func(*options)
+
+// WithRedaction replaces DefaultRedactionRules
+func WithRedaction(rules RedactionRules) Option {
+	return func(o *options) { o.redactor = NewRedactor(rules) }
+}
+
+// WithLevel sets the base level, e.g. "debug" or "warn"
+func WithLevel(level string) Option {
+	return func(o *options) { o.level = level }
+}
+
+// WithModuleLevels overrides the level of loggers returned by Module
+func WithModuleLevels(modules map[string]string) Option {
+	return func(o *options) { o.modules = modules }
+}
+
+// WithEncoding selects "json" or "console"
+func WithEncoding(encoding string) Option {
+	return func(o *options) { o.encoding = encoding }
+}
+
+// WithSampling logs the first initial entries with the same level and
+// message per tick, then every thereafter-th. initial 0 disables it.
+func WithSampling(initial, thereafter int, tick time.Duration) Option {
+	return func(o *options) {
+		o.sampleInitial, o.sampleThereafter, o.sampleTick = initial, thereafter, tick
+	}
+}
+
+// WithTelegram also forwards entries to t. They are redacted but not
+// sampled; t deduplicates them itself.
+func WithTelegram(t *Telegram) Option {
+	return func(o *options) { o.telegram = t }
+}
+
+// WithSlogHandler writes entries to h instead of stderr, e.g. to share
+// a handler the application already uses with log/slog. Levels,
+// sampling and redaction still apply; WithEncoding is ignored.
+func WithSlogHandler(h slog.Handler) Option {
+	return func(o *options) { o.slog = h }
+}
+
+// New builds the logger for env: JSON at info with sampling in
+// production, colored console at debug otherwise. Entries are redacted
+// with DefaultRedactionRules unless WithRedaction is given.
+//
+// If the options are invalid New returns the error together with a
+// fallback logger writing JSON to stderr at info, so callers can log
+// the problem and keep running.
+func New(env string, opts ...Option) (*Logger, error) {
+	production := env == "production"
+
+	o := &options{
+		redactor: NewRedactor(DefaultRedactionRules()),
+		level:    "debug",
+		encoding: "console",
+	}
+	if production {
+		o.level, o.encoding = "info", "json"
+		o.sampleInitial, o.sampleThereafter = 100, 100
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	l, err := build(o, production)
+	if err != nil {
+		return fallback(o.redactor), fmt.Errorf("logger: %w", err)
+	}
+	return l, nil
 }
 
-func New(env string) *Logger {
-	var config zap.Config
+// NewFromConfig builds the logger of a service from its LOG_* settings
+func NewFromConfig(svc config.ServiceConfig, cfg config.LogConfig, opts ...Option) (*Logger, error) {
+	base := []Option{
+		WithLevel(cfg.Level),
+		WithModuleLevels(cfg.Modules),
+		WithSampling(cfg.SamplingInitial, cfg.SamplingThereafter, cfg.SamplingTick),
+	}
+	if cfg.Encoding != "" {
+		base = append(base, WithEncoding(cfg.Encoding))
+	}
+
+	l, err := New(svc.Environment, append(base, opts...)...)
+	return l.WithService(svc.Name), err
+}
+
+func build(o *options, production bool) (*Logger, error) {
+	level, err := zapcore.ParseLevel(o.level)
+	if err != nil {
+		return nil, err
+	}
+	levels := newLevels(level)
+	if err := levels.SetModules(o.modules); err != nil {
+		return nil, err
+	}
 
-	if env == "production" {
-		config = zap.NewProductionConfig()
-		config.EncoderConfig.TimeKey = "timestamp"
-		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	sink, _, err := zap.Open("stderr")
+	if err != nil {
+		return nil, err
+	}
+
+	var out zapcore.Core
+	if o.slog != nil {
+		out = &slogCore{h: o.slog}
 	} else {
-		config = zap.NewDevelopmentConfig()
-		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		enc, err := newEncoder(o.encoding, production)
+		if err != nil {
+			return nil, err
+		}
+		out = zapcore.NewCore(enc, sink, zapcore.DebugLevel)
+	}
+
+	// Levels filter in levelCore, so everything below accepts debug.
+	// The sampler must sit above redactCore: it decides in Check, which
+	// redactCore does not delegate.
+	core := o.redactor.Core(out)
+	if o.sampleInitial > 0 {
+		tick := o.sampleTick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		core = zapcore.NewSamplerWithOptions(core, tick, o.sampleInitial, o.sampleThereafter)
+	}
+	if o.telegram != nil {
+		core = zapcore.NewTee(core, o.redactor.Core(o.telegram.Core()))
 	}
+	core = &levelCore{Core: core, levels: levels}
 
-	logger, _ := config.Build()
-	return &Logger{logger.Sugar()}
+	zopts := []zap.Option{zap.ErrorOutput(sink), zap.AddCaller()}
+	if production {
+		zopts = append(zopts, zap.AddStacktrace(zapcore.ErrorLevel))
+	} else {
+		zopts = append(zopts, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
+	}
+
+	return &Logger{SugaredLogger: zap.New(core, zopts...).Sugar(), levels: levels}, nil
 }
 
-func (l *Logger) WithContext(ctx context.Context) *Logger {
-	// Extract request ID, user ID, etc. from context
-	fields := []interface{}{}
+func newEncoder(encoding string, production bool) (zapcore.Encoder, error) {
+	var encCfg zapcore.EncoderConfig
+	if production {
+		encCfg = zap.NewProductionEncoderConfig()
+		encCfg.TimeKey = "timestamp"
+		encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	} else {
+		encCfg = zap.NewDevelopmentEncoderConfig()
+	}
 
-	if reqID, ok := ctx.Value("request_id").(string); ok {
-		fields = append(fields, "request_id", reqID)
+	switch encoding {
+	case "json":
+		return zapcore.NewJSONEncoder(encCfg), nil
+	case "console":
+		if !production {
+			encCfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encCfg), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
 	}
+}
+
+// fallback cannot fail: JSON on stderr at info, still redacted
+func fallback(redactor *Redactor) *Logger {
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.TimeKey = "timestamp"
+	encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	levels := newLevels(zapcore.InfoLevel)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encCfg), zapcore.Lock(os.Stderr), zapcore.DebugLevel)
+	core = &levelCore{Core: redactor.Core(core), levels: levels}
 
-	if userID, ok := ctx.Value("user_id").(int64); ok {
-		fields = append(fields, "user_id", userID)
+	return &Logger{SugaredLogger: zap.New(core, zap.AddCaller()).Sugar(), levels: levels}
+}
+
+// Levels controls the level of this logger and all loggers derived from
+// it at runtime. It is an http.Handler for an admin endpoint. A Logger
+// built outside New has no runtime levels and gets ErrFixedLevels.
+func (l *Logger) Levels() (*Levels, error) {
+	if l.levels == nil {
+		return nil, ErrFixedLevels
 	}
+	return l.levels, nil
+}
 
-	return &Logger{l.SugaredLogger.With(fields...)}
+// ApplyConfig updates the level and module overrides, e.g. from a
+// config.Subscribe callback
+func (l *Logger) ApplyConfig(cfg config.LogConfig) error {
+	levels, err := l.Levels()
+	if err != nil {
+		return err
+	}
+	if err := levels.SetLevel(cfg.Level); err != nil {
+		return err
+	}
+	return levels.SetModules(cfg.Modules)
+}
+
+// Module returns a named logger whose level can be overridden on its
+// own through LOG_MODULES or Levels, e.g. Module("gorm")
+func (l *Logger) Module(name string) *Logger {
+	z := l.Desugar().WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		if lc, ok := c.(*levelCore); ok {
+			return &levelCore{Core: lc.Core, levels: lc.levels, module: name}
+		}
+		return c
+	})).Named(name)
+	return &Logger{SugaredLogger: z.Sugar(), levels: l.levels}
+}
+
+// WithOptions applies zap options, keeping the runtime levels
+func (l *Logger) WithOptions(opts ...zap.Option) *Logger {
+	return &Logger{SugaredLogger: l.Desugar().WithOptions(opts...).Sugar(), levels: l.levels}
+}
+
+// WithContext adds the request ID, user, caller service and trace
+// stored in ctx by pkg/reqctx
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	fields := contextFields(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &Logger{SugaredLogger: l.Desugar().With(fields...).Sugar(), levels: l.levels}
+}
+
+func contextFields(ctx context.Context) []zap.Field {
+	var fields []zap.Field
+
+	if reqID, ok := reqctx.RequestID(ctx); ok {
+		fields = append(fields, zap.String("request_id", reqID))
+	}
+	if userID, ok := reqctx.UserID(ctx); ok {
+		fields = append(fields, zap.Uint64("user_id", userID))
+	}
+	if tgID, ok := reqctx.TelegramID(ctx); ok {
+		fields = append(fields, zap.Int64("telegram_id", tgID))
+	}
+	// "service" is this service, set by WithService; "caller" is the
+	// code location added by zap
+	if caller, ok := reqctx.Service(ctx); ok {
+		fields = append(fields, zap.String("caller_service", caller))
+	}
+	if t, ok := reqctx.TraceFromContext(ctx); ok {
+		fields = append(fields, zap.String("trace_id", t.TraceID), zap.String("span_id", t.SpanID))
+	}
+	return fields
 }
 
 func (l *Logger) WithService(serviceName string) *Logger {
-	return &Logger{l.SugaredLogger.With("service", serviceName)}
+	return &Logger{SugaredLogger: l.SugaredLogger.With("service", serviceName), levels: l.levels}
 }
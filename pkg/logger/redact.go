@@ -0,0 +1,263 @@
+// pkg/logger/redact.go
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redactedValue = "******"
+
+// RedactionRules decide what is masked before an entry reaches a core.
+// Field names are compared case-insensitively with "_" and "-"
+// removed, so wallet_signature, WalletSignature and wallet-signature
+// are the same name. Nested fields of logged structs and maps are
+// checked too.
+type RedactionRules struct {
+	// Fields are masked when their name equals one of these
+	Fields []string
+	// FieldSubstrings mask every field whose name contains one of these
+	FieldSubstrings []string
+	// Patterns are masked wherever they occur in messages and values
+	Patterns []*regexp.Regexp
+}
+
+// Patterns matched by DefaultRedactionRules
+var (
+	PatternJWT           = regexp.MustCompile(`eyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`)
+	PatternBotToken      = regexp.MustCompile(`\d{6,12}:[A-Za-z0-9_-]{35}`)
+	PatternPrivateKeyPEM = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`)
+	PatternExtendedKey   = regexp.MustCompile(`\b[xyzt]prv[1-9A-HJ-NP-Za-km-z]{100,112}\b`)
+	// 12 to 24 consecutive lowercase words of 3-8 letters, the shape of
+	// BIP-39 and TON mnemonics. Prose rarely matches: short words like
+	// "a", "to" and "of" break the run.
+	PatternMnemonic = regexp.MustCompile(`\b(?:[a-z]{3,8}[ \t\n]+){11,23}[a-z]{3,8}\b`)
+	// Telegram Mini App init data, which is signed and identifies the user
+	PatternInitData = regexp.MustCompile(`\S*auth_date=\S*`)
+)
+
+// DefaultRedactionRules covers credentials, wallet secrets and the
+// personal data stored on models.User and models.ScanResult
+func DefaultRedactionRules() RedactionRules {
+	return RedactionRules{
+		Fields: []string{
+			"token", "accesstoken", "refreshtoken", "idtoken", "bottoken", "servicetoken", "xservicetoken",
+			"authorization", "cookie", "setcookie",
+			"signature", "walletsignature", "proof", "stateinit",
+			"ip", "lastip", "ipaddress", "clientip", "remoteaddr", "xforwardedfor", "xrealip",
+			"initdata", "phone", "phonenumber", "email",
+		},
+		FieldSubstrings: []string{"password", "secret", "mnemonic", "privatekey", "seedphrase", "apikey"},
+		Patterns: []*regexp.Regexp{
+			PatternPrivateKeyPEM, PatternJWT, PatternBotToken, PatternExtendedKey, PatternMnemonic, PatternInitData,
+		},
+	}
+}
+
+// Redactor masks fields and values according to RedactionRules
+type Redactor struct {
+	fields     map[string]bool
+	substrings []string
+	patterns   []*regexp.Regexp
+}
+
+func NewRedactor(rules RedactionRules) *Redactor {
+	r := &Redactor{
+		fields:   make(map[string]bool, len(rules.Fields)),
+		patterns: rules.Patterns,
+	}
+	for _, f := range rules.Fields {
+		r.fields[normalizeFieldName(f)] = true
+	}
+	for _, s := range rules.FieldSubstrings {
+		r.substrings = append(r.substrings, normalizeFieldName(s))
+	}
+	return r
+}
+
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(name)
+}
+
+// SensitiveField reports whether values logged under name are masked
+func (r *Redactor) SensitiveField(name string) bool {
+	n := normalizeFieldName(name)
+	if r.fields[n] {
+		return true
+	}
+	for _, s := range r.substrings {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// String masks every pattern match in s
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// Core wraps core so every entry is redacted before it is encoded
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core, r: r}
+}
+
+type redactCore struct {
+	zapcore.Core
+	r *Redactor
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.r.Fields(fields)), r: c.r}
+}
+
+// Check registers this core, not the wrapped one, so Write below runs
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.String(ent.Message)
+	return c.Core.Write(ent, c.r.Fields(fields))
+}
+
+// Fields returns a redacted copy of fields
+func (r *Redactor) Fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = r.field(f)
+	}
+	return out
+}
+
+func (r *Redactor) field(f zapcore.Field) zapcore.Field {
+	if f.Type == zapcore.NamespaceType || f.Type == zapcore.SkipType {
+		return f
+	}
+	if r.SensitiveField(f.Key) {
+		return zap.String(f.Key, redactedValue)
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.String(f.String)
+		return f
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		if b, ok := f.Interface.([]byte); ok {
+			if s := string(b); r.String(s) != s {
+				return zap.String(f.Key, r.String(s))
+			}
+		}
+		return f
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			if msg := err.Error(); r.String(msg) != msg {
+				return zap.String(f.Key, r.String(msg))
+			}
+		}
+		return f
+	case zapcore.StringerType:
+		if s, ok := stringerValue(f.Interface); ok {
+			return zap.String(f.Key, r.String(s))
+		}
+		return f
+	case zapcore.ReflectType:
+		return zap.Any(f.Key, r.value(jsonValue(f.Interface)))
+	case zapcore.ObjectMarshalerType, zapcore.InlineMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		if m, ok := f.Interface.(zapcore.ObjectMarshaler); ok && m.MarshalLogObject(enc) == nil {
+			if f.Type == zapcore.InlineMarshalerType {
+				return zap.Inline(redactedObject(r.value(enc.Fields).(map[string]interface{})))
+			}
+			return zap.Any(f.Key, r.value(enc.Fields))
+		}
+		return f
+	case zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		if m, ok := f.Interface.(zapcore.ArrayMarshaler); ok && enc.AddArray("v", m) == nil {
+			return zap.Any(f.Key, r.value(enc.Fields["v"]))
+		}
+		return f
+	default:
+		return f
+	}
+}
+
+// value redacts decoded data: sensitive map keys and pattern matches
+func (r *Redactor) value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return r.String(t)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			if r.SensitiveField(k) && item != nil {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = r.value(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = r.value(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// jsonValue converts v to maps, slices and scalars the way it would be
+// logged, so struct fields can be inspected by name
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return string(b)
+	}
+	return out
+}
+
+// stringerValue calls String, which may panic on nil receivers; zap
+// would report those itself, so the field is then left as is
+func stringerValue(v interface{}) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	st, isStringer := v.(fmt.Stringer)
+	if !isStringer {
+		return "", false
+	}
+	return st.String(), true
+}
+
+type redactedObject map[string]interface{}
+
+func (o redactedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for k, v := range o {
+		if err := enc.AddReflected(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/walletYabPangu/shared/pkg/reqctx"
+)
+
+func newSlogTestLogger(t *testing.T, buf *bytes.Buffer) *Logger {
+	t.Helper()
+	h := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	l, err := New("production", WithSlogHandler(h), WithSampling(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.WithService("auth")
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestSlogMatchesZap(t *testing.T) {
+	var buf bytes.Buffer
+	l := newSlogTestLogger(t, &buf)
+
+	ctx := reqctx.WithRequestID(context.Background(), "req-1")
+	ctx = reqctx.WithUserID(ctx, 42)
+
+	l.WithContext(ctx).Infow("login", "method", "password", "attempt", 2)
+	l.Slog().InfoContext(ctx, "login", "method", "password", "attempt", 2)
+
+	lines := decodeLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	for _, key := range []string{"msg", "level", "service", "request_id", "user_id", "method", "attempt"} {
+		if lines[0][key] != lines[1][key] {
+			t.Errorf("%s: zap %v, slog %v", key, lines[0][key], lines[1][key])
+		}
+	}
+	if lines[1]["service"] != "auth" || lines[1]["request_id"] != "req-1" {
+		t.Errorf("slog entry lacks service or context fields: %v", lines[1])
+	}
+}
+
+func TestSlogLevelsAndRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	l := newSlogTestLogger(t, &buf)
+	s := l.Slog()
+
+	s.Debug("hidden at info")
+	s.WithGroup("db").Error("connect failed", "password", "pg-secret-value", "host", "db.internal")
+	levels, err := l.Levels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := levels.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	s.Debug("shown at debug")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden at info") || !strings.Contains(out, "shown at debug") {
+		t.Errorf("slog ignored runtime levels:\n%s", out)
+	}
+	if strings.Contains(out, "pg-secret-value") {
+		t.Errorf("slog output contains secret:\n%s", out)
+	}
+	if !strings.Contains(out, `"db.host":"db.internal"`) {
+		t.Errorf("group not flattened:\n%s", out)
+	}
+}
@@ -0,0 +1,512 @@
+// pkg/logger/telegram.go
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/walletYabPangu/shared/config"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	// Telegram rejects longer messages
+	telegramMaxMessage = 4096
+	telegramMaxPending = 200
+)
+
+// TelegramConfig configures forwarding of log entries to a chat
+type TelegramConfig struct {
+	Token  string
+	ChatID int64
+	// APIURL replaces https://api.telegram.org, e.g. with an httptest
+	// server
+	APIURL string
+	// Service and Instance head every message
+	Service, Instance string
+
+	// Level selects forwarded entries, ErrorLevel and above by default
+	Level zapcore.LevelEnabler
+	// FlushInterval batches entries into one message
+	FlushInterval time.Duration
+	// DedupWindow drops entries identical to one sent less than this
+	// ago; when it ends, a summary says how many were dropped
+	DedupWindow time.Duration
+	// RatePerMinute caps sent messages; entries wait in between
+	RatePerMinute int
+
+	Client *http.Client
+}
+
+// TelegramConfigFrom forwards to TELEGRAM_LOG_PANEL_VPN; ok is false
+// when the channel or bot token is not configured
+func TelegramConfigFrom(svc config.ServiceConfig, bot config.BotConfig) (cfg TelegramConfig, ok bool) {
+	if bot.Token == "" || bot.ChannelLogPanel == 0 {
+		return TelegramConfig{}, false
+	}
+	return TelegramConfig{
+		Token:         bot.Token,
+		ChatID:        bot.ChannelLogPanel,
+		APIURL:        bot.APIURL,
+		Service:       svc.Name,
+		Instance:      svc.InstanceID,
+		Level:         zapcore.ErrorLevel,
+		FlushInterval: bot.LogFlushInterval,
+		DedupWindow:   bot.LogDedupWindow,
+		RatePerMinute: bot.LogRateLimit,
+	}, true
+}
+
+// Telegram batches log entries and sends them with the Bot API
+// sendMessage method. Entries at panic and fatal level are sent
+// before Write returns, since the process is about to stop.
+type Telegram struct {
+	cfg      TelegramConfig
+	endpoint string
+	client   *http.Client
+	clock    clock
+
+	mu       sync.Mutex
+	pending  []string
+	dropped  int
+	seen     map[string]*seenEntry
+	nextSend time.Time
+
+	sendMu sync.Mutex
+	wake   chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+type seenEntry struct {
+	sent       time.Time
+	suppressed int
+}
+
+// clock is replaced in tests
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func NewTelegram(cfg TelegramConfig) (*Telegram, error) {
+	return newTelegram(cfg, realClock{})
+}
+
+func newTelegram(cfg TelegramConfig, clk clock) (*Telegram, error) {
+	if cfg.Token == "" || cfg.ChatID == 0 {
+		return nil, errors.New("logger: telegram token and chat id are required")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultTelegramAPIURL
+	}
+	base, err := url.Parse(cfg.APIURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("logger: invalid telegram api url %q", cfg.APIURL)
+	}
+	if cfg.Level == nil {
+		cfg.Level = zapcore.ErrorLevel
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.RatePerMinute <= 0 {
+		cfg.RatePerMinute = 20
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	t := &Telegram{
+		cfg:      cfg,
+		endpoint: strings.TrimRight(base.String(), "/") + "/bot" + cfg.Token + "/sendMessage",
+		client:   cfg.Client,
+		clock:    clk,
+		seen:     make(map[string]*seenEntry),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// Core returns a zapcore.Core writing to t; tee it with the output core
+func (t *Telegram) Core() zapcore.Core {
+	return &telegramCore{t: t}
+}
+
+// Flush sends everything pending, waiting for the rate limit if needed.
+// It gives up at once if the wait would outlast the ctx deadline.
+func (t *Telegram) Flush(ctx context.Context) error {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	for {
+		text, wait, ok := t.next()
+		if !ok {
+			return nil
+		}
+		if wait > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				t.requeue(text)
+				return context.DeadlineExceeded
+			}
+			select {
+			case <-ctx.Done():
+				t.requeue(text)
+				return ctx.Err()
+			case <-t.clock.After(wait):
+			}
+		}
+		if err := t.send(ctx, text); err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops the background sender after a last flush
+func (t *Telegram) Close() error {
+	var err error
+	t.closed.Do(func() {
+		close(t.done)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = t.Flush(ctx)
+	})
+	return err
+}
+
+func (t *Telegram) run() {
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		case <-t.wake:
+		}
+		if err := t.flushAvailable(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: telegram: %v\n", err)
+		}
+	}
+}
+
+// flushAvailable sends what the rate limit allows now and leaves the
+// rest for the next tick
+func (t *Telegram) flushAvailable() error {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	for {
+		text, wait, ok := t.next()
+		if !ok {
+			return nil
+		}
+		if wait > 0 {
+			t.requeue(text)
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := t.send(ctx, text)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// add queues text unless an identical entry was sent within the dedup
+// window. key identifies the entry regardless of time and fields.
+func (t *Telegram) add(key, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cfg.DedupWindow > 0 {
+		now := t.clock.Now()
+		t.expire(now)
+		if s, ok := t.seen[key]; ok {
+			s.suppressed++
+			return
+		}
+		t.seen[key] = &seenEntry{sent: now}
+	}
+	t.enqueue(text)
+}
+
+// expire forgets entries whose dedup window ended, queueing a summary
+// for those that suppressed repeats. t.mu must be held.
+func (t *Telegram) expire(now time.Time) {
+	for key, s := range t.seen {
+		if now.Sub(s.sent) < t.cfg.DedupWindow {
+			continue
+		}
+		if s.suppressed > 0 {
+			t.enqueue(t.summary(key, s.suppressed))
+		}
+		delete(t.seen, key)
+	}
+}
+
+// summary reports n entries dropped for key, built by telegramCore.Write
+func (t *Telegram) summary(key string, n int) string {
+	parts := strings.SplitN(key, "|", 4)
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(parts[0]))
+	if t.cfg.Service != "" {
+		fmt.Fprintf(&b, " [%s]", t.cfg.Service)
+	}
+	if t.cfg.Instance != "" {
+		fmt.Fprintf(&b, " %s", t.cfg.Instance)
+	}
+	fmt.Fprintf(&b, "\n%s\n(suppressed %d times in %s)", parts[len(parts)-1], n, t.cfg.DedupWindow)
+	return b.String()
+}
+
+// enqueue appends text, dropping the oldest entry when full. t.mu must
+// be held.
+func (t *Telegram) enqueue(text string) {
+	if len(t.pending) >= telegramMaxPending {
+		t.pending = t.pending[1:]
+		t.dropped++
+	}
+	t.pending = append(t.pending, text)
+}
+
+// next joins pending entries into one message and reports how long the
+// rate limit requires to wait before sending it
+func (t *Telegram) next() (text string, wait time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	if t.cfg.DedupWindow > 0 {
+		t.expire(now)
+	}
+	if len(t.pending) == 0 && t.dropped == 0 {
+		return "", 0, false
+	}
+
+	var b strings.Builder
+	if t.dropped > 0 {
+		fmt.Fprintf(&b, "(%d entries dropped, queue full)", t.dropped)
+		t.dropped = 0
+	}
+	n := 0
+	for ; n < len(t.pending); n++ {
+		entry := t.pending[n]
+		if b.Len() > 0 {
+			if b.Len()+2+len(entry) > telegramMaxMessage {
+				break
+			}
+			b.WriteString("\n\n")
+		}
+		if len(entry) > telegramMaxMessage-b.Len() {
+			entry = truncate(entry, telegramMaxMessage-b.Len())
+		}
+		b.WriteString(entry)
+	}
+	t.pending = t.pending[n:]
+
+	if t.nextSend.After(now) {
+		wait = t.nextSend.Sub(now)
+	}
+	return b.String(), wait, true
+}
+
+func (t *Telegram) requeue(text string) {
+	t.mu.Lock()
+	t.pending = append([]string{text}, t.pending...)
+	t.mu.Unlock()
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (t *Telegram) send(ctx context.Context, text string) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"chat_id":                  t.cfg.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+
+	t.mu.Lock()
+	t.nextSend = t.clock.Now().Add(time.Minute / time.Duration(t.cfg.RatePerMinute))
+	t.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("cannot build request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// url.Error carries the URL, which contains the bot token
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var res telegramResponse
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode == http.StatusTooManyRequests && res.Parameters.RetryAfter > 0 {
+		t.mu.Lock()
+		t.nextSend = t.clock.Now().Add(time.Duration(res.Parameters.RetryAfter) * time.Second)
+		t.mu.Unlock()
+		t.requeue(text)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK || !res.OK {
+		return fmt.Errorf("send: status %d: %s", resp.StatusCode, res.Description)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	const marker = "\n…"
+	if len(s) <= n {
+		return s
+	}
+	if n <= len(marker) {
+		return s[:n]
+	}
+	s = s[:n-len(marker)]
+	// do not cut a multi-byte rune in half
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				s = s[:i]
+			}
+			break
+		}
+	}
+	return s + marker
+}
+
+type telegramCore struct {
+	t      *Telegram
+	fields []zapcore.Field
+}
+
+func (c *telegramCore) Enabled(lvl zapcore.Level) bool {
+	return c.t.cfg.Level.Enabled(lvl)
+}
+
+func (c *telegramCore) With(fields []zapcore.Field) zapcore.Core {
+	return &telegramCore{t: c.t, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *telegramCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *telegramCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// A wrapping core may register itself in Check and write to a tee of
+	// cores with different levels
+	if !c.Enabled(ent.Level) {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	key := ent.Level.String() + "|" + ent.LoggerName + "|" + ent.Caller.TrimmedPath() + "|" + ent.Message
+	c.t.add(key, c.format(ent, enc.Fields))
+
+	if ent.Level > zapcore.ErrorLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return c.t.Flush(ctx)
+	}
+	select {
+	case c.t.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// format renders an entry as plain text; no parse mode, so nothing
+// needs escaping
+func (c *telegramCore) format(ent zapcore.Entry, fields map[string]interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s", strings.ToUpper(ent.Level.String()))
+	if svc, ok := fields["service"].(string); ok && svc != "" {
+		fmt.Fprintf(&b, " [%s]", svc)
+		delete(fields, "service")
+	} else if c.t.cfg.Service != "" {
+		fmt.Fprintf(&b, " [%s]", c.t.cfg.Service)
+	}
+	if c.t.cfg.Instance != "" {
+		fmt.Fprintf(&b, " %s", c.t.cfg.Instance)
+	}
+	fmt.Fprintf(&b, " %s\n%s", ent.Time.UTC().Format(time.RFC3339), ent.Message)
+	if ent.LoggerName != "" {
+		fmt.Fprintf(&b, "\nlogger: %s", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		fmt.Fprintf(&b, "\ncaller: %s", ent.Caller.TrimmedPath())
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fields[k]
+		if s, ok := v.(string); ok {
+			fmt.Fprintf(&b, "\n%s: %s", k, s)
+			continue
+		}
+		j, err := json.Marshal(v)
+		if err != nil {
+			j = []byte(fmt.Sprint(v))
+		}
+		fmt.Fprintf(&b, "\n%s: %s", k, j)
+	}
+
+	if ent.Stack != "" {
+		fmt.Fprintf(&b, "\n\n%s", truncate(ent.Stack, 1500))
+	}
+	return b.String()
+}
+
+func (c *telegramCore) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.t.Flush(ctx)
+}
@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// telegramStub records sendMessage calls
+type telegramStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	paths    []string
+	messages []string
+	// retryAfter answers the next call with 429
+	retryAfter int
+}
+
+func newTelegramStub(t *testing.T) *telegramStub {
+	s := &telegramStub{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ChatID int64  `json:"chat_id"`
+			Text   string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.retryAfter > 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Too Many Requests","parameters":{"retry_after":1}}`))
+			s.retryAfter = 0
+			return
+		}
+		s.paths = append(s.paths, r.URL.Path)
+		s.messages = append(s.messages, req.Text)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *telegramStub) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+// fakeClock only moves when advanced; After advances it at once
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// newTestTelegram never flushes on its own: the interval is an hour and
+// the clock is fake, so tests flush explicitly
+func newTestTelegram(t *testing.T, stub *telegramStub, cfg TelegramConfig) (*Telegram, *zap.Logger, *fakeClock) {
+	cfg.Token, cfg.ChatID, cfg.APIURL = testBotToken, -100123, stub.URL
+	cfg.FlushInterval = time.Hour
+	clk := &fakeClock{now: time.Unix(1760000000, 0)}
+	tg, err := newTelegram(cfg, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tg.Close() })
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&strings.Builder{}), zapcore.DebugLevel)
+	r := NewRedactor(DefaultRedactionRules())
+	return tg, zap.New(zapcore.NewTee(r.Core(core), r.Core(tg.Core()))), clk
+}
+
+func TestTelegramBatchesErrors(t *testing.T) {
+	stub := newTelegramStub(t)
+	tg, log, _ := newTestTelegram(t, stub, TelegramConfig{Service: "auth"})
+
+	log.Info("not forwarded")
+	log.Error("first failure", zap.Int("attempt", 1))
+	log.With(zap.String("module", "payments")).Error("second failure", zap.String("access_token", testJWT))
+	if err := tg.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stub.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want one batch: %q", len(sent), sent)
+	}
+	msg := sent[0]
+	for _, want := range []string{"ERROR [auth]", "first failure", "attempt: 1", "second failure", "module: payments"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "not forwarded") || strings.Contains(msg, testJWT) {
+		t.Errorf("message has info entry or secret:\n%s", msg)
+	}
+	if stub.paths[0] != "/bot"+testBotToken+"/sendMessage" {
+		t.Errorf("path = %s", stub.paths[0])
+	}
+}
+
+func TestTelegramDeduplicates(t *testing.T) {
+	stub := newTelegramStub(t)
+	tg, log, clk := newTestTelegram(t, stub, TelegramConfig{Service: "auth", DedupWindow: time.Minute, RatePerMinute: 6000})
+
+	for i := 0; i < 5; i++ {
+		log.Error("database unreachable", zap.Int("attempt", i))
+	}
+	_ = tg.Flush(context.Background())
+	clk.Advance(time.Minute)
+	log.Error("database unreachable", zap.Int("attempt", 5))
+	_ = tg.Flush(context.Background())
+
+	sent := stub.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d messages, want 2: %q", len(sent), sent)
+	}
+	if strings.Count(sent[0], "database unreachable") != 1 {
+		t.Errorf("duplicates were not dropped:\n%s", sent[0])
+	}
+	if !strings.Contains(sent[1], "ERROR [auth]\ndatabase unreachable\n(suppressed 4 times in 1m0s)") {
+		t.Errorf("suppressed count missing:\n%s", sent[1])
+	}
+	if !strings.Contains(sent[1], "attempt: 5") {
+		t.Errorf("entry after the window was dropped:\n%s", sent[1])
+	}
+}
+
+func TestTelegramReportsSuppressedOnExpiry(t *testing.T) {
+	stub := newTelegramStub(t)
+	tg, log, clk := newTestTelegram(t, stub, TelegramConfig{DedupWindow: time.Minute, RatePerMinute: 6000})
+
+	log.Error("cache miss storm")
+	log.Error("cache miss storm")
+	log.Error("cache miss storm")
+	log.Error("single failure")
+	_ = tg.Flush(context.Background())
+
+	// No identical entry follows; the summary is sent once the window ends
+	clk.Advance(time.Minute)
+	if err := tg.flushAvailable(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stub.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d messages, want 2: %q", len(sent), sent)
+	}
+	if !strings.Contains(sent[1], "cache miss storm\n(suppressed 2 times") || strings.Contains(sent[1], "single failure") {
+		t.Errorf("unexpected summary:\n%s", sent[1])
+	}
+
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	if len(tg.seen) != 0 {
+		t.Errorf("%d expired entries kept", len(tg.seen))
+	}
+}
+
+func TestTelegramRateLimit(t *testing.T) {
+	stub := newTelegramStub(t)
+	tg, log, clk := newTestTelegram(t, stub, TelegramConfig{RatePerMinute: 1})
+
+	log.Error("first")
+	if err := tg.flushAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	log.Error("second")
+	if err := tg.flushAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	if sent := stub.sent(); len(sent) != 1 || !strings.Contains(sent[0], "first") {
+		t.Fatalf("sent %q, want only the first message before the limit", sent)
+	}
+
+	// Flush waits for the limit unless the deadline is too close
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tg.Flush(ctx); err == nil {
+		t.Fatal("Flush ignored the rate limit")
+	}
+	if len(stub.sent()) != 1 {
+		t.Fatal("second message sent within the rate limit")
+	}
+
+	clk.Advance(time.Minute)
+	if err := tg.flushAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	if sent := stub.sent(); len(sent) != 2 || !strings.Contains(sent[1], "second") {
+		t.Fatalf("sent %q, want the second message after a minute", sent)
+	}
+}
+
+func TestTelegramRetryAfter(t *testing.T) {
+	stub := newTelegramStub(t)
+	stub.retryAfter = 1
+	tg, log, clk := newTestTelegram(t, stub, TelegramConfig{RatePerMinute: 6000})
+
+	log.Error("throttled")
+	start := clk.Now()
+	if err := tg.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sent := stub.sent(); len(sent) != 1 || !strings.Contains(sent[0], "throttled") {
+		t.Fatalf("sent %q, want the entry after retry", sent)
+	}
+	if clk.Now().Sub(start) < time.Second {
+		t.Error("retry_after was not respected")
+	}
+}
+
+func TestTelegramSendsPanicLevelImmediately(t *testing.T) {
+	stub := newTelegramStub(t)
+	_, log, _ := newTestTelegram(t, stub, TelegramConfig{})
+
+	log.DPanic("invariant broken")
+	if sent := stub.sent(); len(sent) != 1 || !strings.Contains(sent[0], "DPANIC") {
+		t.Fatalf("sent %q, want the entry before DPanic returns", sent)
+	}
+}
@@ -0,0 +1,128 @@
+// pkg/middleware/auth.go
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/walletYabPangu/shared"
+	"github.com/walletYabPangu/shared/pkg/reqctx"
+)
+
+const RequestIDHeader = reqctx.HeaderRequestID
+
+const (
+	CodeTokenExpired = "token_expired"
+	CodeTokenRevoked = "token_revoked"
+)
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims of the token verified by Authenticate
+func ClaimsFromContext(ctx context.Context) (*shared.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*shared.Claims)
+	return claims, ok
+}
+
+// Roles returns the roles of the authenticated user, if any
+func Roles(ctx context.Context) []string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.Roles
+	}
+	return nil
+}
+
+// RequestID reuses the incoming X-Request-ID or generates one, stores
+// it in the context and echoes it on the response. An incoming W3C
+// traceparent is kept as well.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if _, ok := reqctx.RequestID(r.Context()); ok {
+		return r
+	}
+
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+
+	ctx := reqctx.WithRequestID(r.Context(), id)
+	if t, ok := reqctx.ParseTraceParent(r.Header.Get(reqctx.HeaderTraceParent)); ok {
+		ctx = reqctx.WithTrace(ctx, t)
+	}
+	return r.WithContext(ctx)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Authenticate requires a bearer access token verified by j and stores
+// the request ID, user, roles and claims in the request context.
+func Authenticate(j shared.IJWT) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = withRequestID(w, r)
+
+			token, ok := bearerToken(r)
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, CodeUnauthorized, "missing bearer token")
+				return
+			}
+
+			claims, err := j.ParseToken(r.Context(), token)
+			if err != nil {
+				writeTokenError(w, err)
+				return
+			}
+
+			ctx := reqctx.WithUserID(r.Context(), claims.UserID)
+			ctx = reqctx.WithTelegramID(ctx, claims.TelegramID)
+			ctx = reqctx.WithRoles(ctx, claims.Roles)
+			ctx = context.WithValue(ctx, claimsKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, shared.ErrTokenExpired):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+		WriteError(w, http.StatusUnauthorized, CodeTokenExpired, "token expired")
+	case errors.Is(err, shared.ErrTokenRevoked):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		WriteError(w, http.StatusUnauthorized, CodeTokenRevoked, "token revoked")
+	case errors.Is(err, shared.ErrTokenMalformed),
+		errors.Is(err, shared.ErrTokenSignatureInvalid),
+		errors.Is(err, shared.ErrTokenInvalid):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		WriteError(w, http.StatusUnauthorized, CodeUnauthorized, "invalid token")
+	default:
+		// e.g. the revocation store is unreachable
+		WriteError(w, http.StatusServiceUnavailable, CodeInternal, "cannot verify token")
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/walletYabPangu/shared"
+	"github.com/walletYabPangu/shared/pkg/reqctx"
+	"github.com/walletYabPangu/shared/types"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// revoker answers IsRevoked with fixed values
+type revoker struct {
+	revoked bool
+	err     error
+}
+
+func (r revoker) IsRevoked(context.Context, *shared.Claims) (bool, error) {
+	return r.revoked, r.err
+}
+
+func issue(t *testing.T, opts ...shared.JwtOption) string {
+	t.Helper()
+	token, err := shared.JwtNew(testSecret, opts...).GenerateToken(42, 1042, []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	valid := issue(t)
+	tests := []struct {
+		name    string
+		header  string
+		revoker shared.TokenRevoker
+		status  int
+		code    string
+	}{
+		{"missing header", "", nil, http.StatusUnauthorized, CodeUnauthorized},
+		{"basic scheme", "Basic " + valid, nil, http.StatusUnauthorized, CodeUnauthorized},
+		{"no token", "Bearer ", nil, http.StatusUnauthorized, CodeUnauthorized},
+		{"malformed", "Bearer not-a-token", nil, http.StatusUnauthorized, CodeUnauthorized},
+		{"expired", "Bearer " + issue(t, shared.WithTTL(-time.Hour)), nil, http.StatusUnauthorized, CodeTokenExpired},
+		{"revoked", "Bearer " + valid, revoker{revoked: true}, http.StatusUnauthorized, CodeTokenRevoked},
+		// Fail closed: an unchecked token is not let through
+		{"revocation store down", "Bearer " + valid, revoker{err: errors.New("redis: connection refused")}, http.StatusServiceUnavailable, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []shared.JwtOption
+			if tt.revoker != nil {
+				opts = append(opts, shared.WithRevocation(tt.revoker))
+			}
+			h := Authenticate(shared.JwtNew(testSecret, opts...))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				t.Error("handler called")
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body types.APIError
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code || body.Message == "" {
+				t.Errorf("body = %+v, want code %s", body, tt.code)
+			}
+			if w.Header().Get(RequestIDHeader) == "" {
+				t.Error("rejected response has no request ID")
+			}
+		})
+	}
+}
+
+func TestAuthenticatePopulatesContext(t *testing.T) {
+	var got struct {
+		claims     *shared.Claims
+		userID     uint64
+		telegramID int64
+		roles      []string
+		requestID  string
+	}
+	h := Authenticate(shared.JwtNew(testSecret, shared.WithRevocation(revoker{})))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		got.claims, _ = ClaimsFromContext(ctx)
+		got.userID, _ = reqctx.UserID(ctx)
+		got.telegramID, _ = reqctx.TelegramID(ctx)
+		got.roles = reqctx.Roles(ctx)
+		got.requestID, _ = reqctx.RequestID(ctx)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/me", nil)
+	r.Header.Set("Authorization", "bearer "+issue(t))
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got.claims == nil || got.claims.UserID != 42 || !got.claims.HasRole("admin") {
+		t.Errorf("claims = %+v", got.claims)
+	}
+	if got.userID != 42 || got.telegramID != 1042 || !reflect.DeepEqual(got.roles, []string{"admin"}) {
+		t.Errorf("reqctx user = %d, telegram = %d, roles = %v", got.userID, got.telegramID, got.roles)
+	}
+	if got.requestID != "req-1" || w.Header().Get(RequestIDHeader) != "req-1" {
+		t.Errorf("request ID = %q, echoed %q", got.requestID, w.Header().Get(RequestIDHeader))
+	}
+}
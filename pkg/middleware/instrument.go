@@ -0,0 +1,252 @@
+// pkg/middleware/instrument.go
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/walletYabPangu/shared/metrics"
+	"github.com/walletYabPangu/shared/pkg/logger"
+)
+
+// Path label of requests whose route is unknown; raw paths are never
+// used as labels
+const (
+	RouteUnmatched = "unmatched"
+	RouteOther     = "other"
+)
+
+type instrumentOptions struct {
+	service string
+	route   func(*http.Request) string
+	skip    map[string]bool
+}
+
+type InstrumentOption func(*instrumentOptions)
+
+// WithServiceLabel labels metrics of metrics.Default with service;
+// instances from metrics.New carry it already
+func WithServiceLabel(service string) InstrumentOption {
+	return func(o *instrumentOptions) { o.service = service }
+}
+
+// WithRoute resolves the route template for routers other than
+// http.ServeMux, e.g. chi.RouteContext(r.Context()).RoutePattern().
+// It runs after the handler; an empty result falls back to the default.
+func WithRoute(fn func(*http.Request) string) InstrumentOption {
+	return func(o *instrumentOptions) { o.route = fn }
+}
+
+// WithSkipPaths serves paths such as /healthz without metrics or
+// access logs
+func WithSkipPaths(paths ...string) InstrumentOption {
+	return func(o *instrumentOptions) {
+		for _, p := range paths {
+			o.skip[p] = true
+		}
+	}
+}
+
+type routeKey struct{}
+
+// SetRoute names the route of the current request for Instrument, for
+// handlers behind middleware that hides http.Request.Pattern
+func SetRoute(ctx context.Context, route string) {
+	if p, ok := ctx.Value(routeKey{}).(*atomic.Value); ok {
+		p.Store(route)
+	}
+}
+
+// Instrument records duration, in-flight, size and panic metrics per
+// route template and writes an access log entry for every request, on
+// the "http" logger module. Panics are recovered and answered with 500;
+// once the response has started they abort it with http.ErrAbortHandler
+// instead, so the client never takes a truncated body for a whole one.
+//
+// The route is, in order: WithRoute, SetRoute, the http.ServeMux
+// pattern of the request, RouteUnmatched for 404 and RouteOther. Place
+// Instrument directly around the mux so the pattern is visible.
+func Instrument(m *metrics.Metrics, log *logger.Logger, opts ...InstrumentOption) func(http.Handler) http.Handler {
+	o := &instrumentOptions{skip: map[string]bool{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	log = log.Module("http")
+	inFlight := m.HTTPRequestsInFlight.WithLabelValues(m.LabelValues(o.service)...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.skip[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			r = withRequestID(w, r)
+			route := &atomic.Value{}
+			r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+			body := &countingBody{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			rec := &responseRecorder{ResponseWriter: w}
+
+			var recovered interface{}
+			var stack []byte
+			func() {
+				defer func() {
+					// the stack must be taken here to include the panic site
+					if recovered = recover(); recovered != nil {
+						stack = debug.Stack()
+					}
+				}()
+				next.ServeHTTP(rec, r)
+			}()
+
+			// a 500 can only replace a response that has not started
+			started := rec.wroteHeader
+			if recovered != nil && recovered != http.ErrAbortHandler && !started {
+				WriteError(rec, http.StatusInternalServerError, CodeInternal, "internal error")
+			}
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if recovered != nil && !started {
+				status = http.StatusInternalServerError
+			}
+			path := o.routeOf(r, route, status)
+			code := strconv.Itoa(status)
+			elapsed := time.Since(start)
+			reqSize := body.n
+			if r.ContentLength > reqSize {
+				reqSize = r.ContentLength
+			}
+
+			m.HTTPRequestDuration.WithLabelValues(m.LabelValues(o.service, r.Method, path, code)...).Observe(elapsed.Seconds())
+			m.HTTPRequestSize.WithLabelValues(m.LabelValues(o.service, r.Method, path)...).Observe(float64(reqSize))
+			m.HTTPResponseSize.WithLabelValues(m.LabelValues(o.service, r.Method, path, code)...).Observe(float64(rec.size))
+
+			fields := []interface{}{
+				"method", r.Method,
+				"route", path,
+				"path", r.URL.Path,
+				"status", status,
+				"duration_ms", float64(elapsed.Microseconds()) / 1000,
+				"bytes_in", reqSize,
+				"bytes_out", rec.size,
+				"user_agent", r.UserAgent(),
+			}
+			entry := log.WithContext(r.Context())
+
+			switch {
+			case recovered == http.ErrAbortHandler:
+				// the handler aborted on purpose; let net/http handle it
+				entry.Infow("request aborted", fields...)
+				panic(recovered)
+			case recovered != nil:
+				m.HTTPPanics.WithLabelValues(m.LabelValues(o.service, r.Method, path)...).Inc()
+				entry.Errorw("panic in handler", append(fields, "panic", fmt.Sprint(recovered), "stack", string(stack))...)
+				if started {
+					panic(http.ErrAbortHandler)
+				}
+			case status >= 500:
+				entry.Warnw("request", fields...)
+			default:
+				entry.Infow("request", fields...)
+			}
+		})
+	}
+}
+
+func (o *instrumentOptions) routeOf(r *http.Request, set *atomic.Value, status int) string {
+	if o.route != nil {
+		if route := o.route(r); route != "" {
+			return route
+		}
+	}
+	if route, ok := set.Load().(string); ok && route != "" {
+		return route
+	}
+	if r.Pattern != "" {
+		// "GET /users/{id}" → "/users/{id}"
+		if _, path, found := strings.Cut(r.Pattern, " "); found {
+			return path
+		}
+		return r.Pattern
+	}
+	if status == http.StatusNotFound {
+		return RouteUnmatched
+	}
+	return RouteOther
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// responseRecorder captures the status and body size
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		// 1xx are informational, the final header follows
+		w.wroteHeader = status >= 200
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseRecorder) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && !w.wroteHeader {
+		w.status, w.wroteHeader = http.StatusSwitchingProtocols, true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/walletYabPangu/shared/metrics"
+	"github.com/walletYabPangu/shared/pkg/logger"
+)
+
+func newTestInstrument(t *testing.T, h http.HandlerFunc, opts ...InstrumentOption) (http.Handler, *metrics.Metrics) {
+	t.Helper()
+	log, err := logger.New("development", logger.WithLevel("fatal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics.New(prometheus.NewRegistry(), "", "auth")
+	return Instrument(m, log, opts...)(h), m
+}
+
+func TestInstrumentRecoversPanic(t *testing.T) {
+	h, m := newTestInstrument(t, func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if n := testutil.ToFloat64(m.HTTPPanics.WithLabelValues(http.MethodGet, RouteOther)); n != 1 {
+		t.Errorf("panics = %v, want 1", n)
+	}
+}
+
+// A 500 can no longer be sent once the response started, so the
+// connection must be aborted rather than the body cut short silently
+func TestInstrumentAbortsPanicAfterHeaders(t *testing.T) {
+	h, m := newTestInstrument(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"items":[`))
+		panic("boom")
+	})
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("panic = %v, want http.ErrAbortHandler", p)
+		}
+		if n := testutil.ToFloat64(m.HTTPPanics.WithLabelValues(http.MethodGet, RouteOther)); n != 1 {
+			t.Errorf("panics = %v, want 1", n)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+}
+
+// observedRoutes lists the distinct path labels of the request
+// duration series
+func observedRoutes(t *testing.T, m *metrics.Metrics) []string {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 16)
+	go func() {
+		m.HTTPRequestDuration.Collect(ch)
+		close(ch)
+	}()
+
+	seen := map[string]bool{}
+	var routes []string
+	for metric := range ch {
+		var out dto.Metric
+		if err := metric.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range out.GetLabel() {
+			if label.GetName() == "path" && !seen[label.GetValue()] {
+				seen[label.GetValue()] = true
+				routes = append(routes, label.GetValue())
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func TestInstrumentRouteLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("/wallets/", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("GET /named/{id}", func(_ http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "/named/:id")
+	})
+
+	tests := []struct {
+		name  string
+		opts  []InstrumentOption
+		paths []string
+		want  []string
+	}{
+		{"ServeMux pattern", nil, []string{"/users/1", "/users/2"}, []string{"/users/{id}"}},
+		{"pattern without method", nil, []string{"/wallets/EQabc"}, []string{"/wallets/"}},
+		{"SetRoute over pattern", nil, []string{"/named/7"}, []string{"/named/:id"}},
+		{"unmatched", nil, []string{"/nope/1", "/nope/2"}, []string{RouteUnmatched}},
+		{"WithRoute over all", []InstrumentOption{WithRoute(func(*http.Request) string { return "/custom" })},
+			[]string{"/users/1", "/named/7", "/nope"}, []string{"/custom"}},
+		{"empty WithRoute falls back", []InstrumentOption{WithRoute(func(*http.Request) string { return "" })},
+			[]string{"/users/1"}, []string{"/users/{id}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, m := newTestInstrument(t, mux.ServeHTTP, tt.opts...)
+			for _, path := range tt.paths {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+			}
+			if got := observedRoutes(t, m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Handlers behind a router other than ServeMux get no pattern
+func TestInstrumentRouteWithoutPattern(t *testing.T) {
+	h, m := newTestInstrument(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	})
+	for _, path := range []string{"/a/1", "/a/2", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if got, want := observedRoutes(t, m), []string{RouteOther, RouteUnmatched}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routes = %v, want %v", got, want)
+	}
+}
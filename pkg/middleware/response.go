@@ -0,0 +1,23 @@
+// pkg/middleware/response.go
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/walletYabPangu/shared/types"
+)
+
+// Error codes written in types.APIError bodies
+const (
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeInternal     = "internal_error"
+)
+
+// WriteError replies with a types.APIError JSON body
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&types.APIError{Code: code, Message: message})
+}
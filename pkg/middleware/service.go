@@ -0,0 +1,92 @@
+// pkg/middleware/service.go
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/walletYabPangu/shared"
+	"github.com/walletYabPangu/shared/pkg/reqctx"
+)
+
+// ServiceTokenHeader carries service-to-service tokens, leaving
+// Authorization free for a forwarded user token.
+const ServiceTokenHeader = "X-Service-Token"
+
+// CallerService returns the service authenticated by RequireService
+func CallerService(ctx context.Context) (string, bool) {
+	return reqctx.Service(ctx)
+}
+
+// ServiceTransport attaches a fresh service token addressed to Target
+// to every outgoing request, and propagates the request context
+// (request ID, user, trace) as reqctx headers.
+type ServiceTransport struct {
+	Base   http.RoundTripper
+	JWT    shared.IJWT
+	Source string
+	Target string
+}
+
+func (t *ServiceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.JWT.GenerateServiceToken(t.Source, t.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	reqctx.InjectHTTP(reqctx.WithService(req.Context(), t.Source), req.Header)
+	req.Header.Set(ServiceTokenHeader, token)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// NewServiceClient returns an http.Client for calls from source to target
+func NewServiceClient(j shared.IJWT, source, target string) *http.Client {
+	return &http.Client{
+		Transport: &ServiceTransport{JWT: j, Source: source, Target: target},
+	}
+}
+
+// RequireService rejects requests without a valid service token
+// addressed to self. When allowed is non-empty only those callers pass.
+// The request context propagated by the caller is restored, with the
+// caller service taken from the verified token. The restored user is
+// only as trustworthy as the caller and carries no roles: handlers that
+// authorize a user need a forwarded access token (Authenticate).
+func RequireService(j shared.IJWT, self string, allowed ...string) func(http.Handler) http.Handler {
+	allow := make(map[string]bool, len(allowed))
+	for _, svc := range allowed {
+		allow[svc] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(ServiceTokenHeader)
+			if token == "" {
+				WriteError(w, http.StatusUnauthorized, CodeUnauthorized, "missing service token")
+				return
+			}
+
+			claims, err := j.ParseServiceToken(r.Context(), token, self)
+			if err != nil {
+				WriteError(w, http.StatusUnauthorized, CodeUnauthorized, "invalid service token")
+				return
+			}
+
+			if len(allow) > 0 && !allow[claims.Service] {
+				WriteError(w, http.StatusForbidden, CodeForbidden, "service "+claims.Service+" is not allowed")
+				return
+			}
+
+			ctx := reqctx.ExtractHTTP(r.Context(), r.Header)
+			ctx = reqctx.WithService(ctx, claims.Service)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// pkg/rbac/migrate.go
+package rbac
+
+import (
+	"github.com/walletYabPangu/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultRoles are seeded once; edits made later through the admin
+// service are kept because existing rows are never overwritten.
+var defaultRoles = []struct {
+	name        string
+	rank        int
+	permissions []string
+}{
+	{RoleOwner, 100, []string{PermAll}},
+	{RoleAdmin, 50, []string{
+		PermUserRead, PermUserBan, PermTaskWrite, PermSkinWrite,
+		PermFishTypeWrite, PermServiceRegistryWrite, PermAuditRead,
+	}},
+	{RoleSupport, 10, []string{PermUserRead, PermUserBan}},
+}
+
+// Migrate creates the access control tables and seeds built-in roles
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.Permission{}, &models.Role{}, &models.UserRole{}); err != nil {
+		return err
+	}
+	return seed(db)
+}
+
+// seed adds missing permissions and built-in roles; it can run any
+// number of times
+func seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		codes := []string{
+			PermAll, PermUserRead, PermUserBan, PermTaskWrite, PermSkinWrite,
+			PermFishTypeWrite, PermServiceRegistryWrite, PermAuditRead, PermRoleManage,
+		}
+		perms := make([]models.Permission, 0, len(codes))
+		for _, c := range codes {
+			perms = append(perms, models.Permission{Code: c})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&perms).Error; err != nil {
+			return err
+		}
+
+		for _, def := range defaultRoles {
+			var count int64
+			if err := tx.Model(&models.Role{}).Where("name = ?", def.name).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			var granted []models.Permission
+			if err := tx.Where("code IN ?", def.permissions).Find(&granted).Error; err != nil {
+				return err
+			}
+			role := models.Role{Name: def.name, Rank: def.rank, IsSystem: true, Permissions: granted}
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
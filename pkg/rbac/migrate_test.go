@@ -0,0 +1,106 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/walletYabPangu/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB creates the access control tables in SQLite. AutoMigrate
+// is not used: the models carry Postgres defaults such as now().
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	for _, stmt := range []string{
+		"CREATE TABLE permissions (id INTEGER PRIMARY KEY AUTOINCREMENT, code VARCHAR(100) NOT NULL UNIQUE, description TEXT, created_at DATETIME)",
+		"CREATE TABLE roles (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(50) NOT NULL UNIQUE, description TEXT, `rank` INTEGER DEFAULT 0, is_system BOOLEAN DEFAULT false, created_at DATETIME, updated_at DATETIME)",
+		"CREATE TABLE role_permissions (role_id INTEGER, permission_id INTEGER, PRIMARY KEY (role_id, permission_id))",
+		"CREATE TABLE user_roles (user_id INTEGER, role_id INTEGER, granted_by INTEGER, created_at DATETIME, PRIMARY KEY (user_id, role_id))",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func rolePermissions(t *testing.T, db *gorm.DB) map[string][]string {
+	t.Helper()
+	var roles []models.Role
+	if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		t.Fatal(err)
+	}
+	out := map[string][]string{}
+	for _, r := range roles {
+		out[r.Name] = []string{}
+		for _, p := range r.Permissions {
+			out[r.Name] = append(out[r.Name], p.Code)
+		}
+	}
+	return out
+}
+
+func TestSeedTwice(t *testing.T) {
+	db := newTestDB(t)
+	if err := seed(db); err != nil {
+		t.Fatal(err)
+	}
+	first := rolePermissions(t, db)
+	if len(first) != len(defaultRoles) || len(first[RoleAdmin]) != 7 || first[RoleOwner][0] != PermAll {
+		t.Fatalf("seeded roles = %v", first)
+	}
+
+	if err := seed(db); err != nil {
+		t.Fatalf("second seed: %v", err)
+	}
+	var permissions, roles, grants int64
+	db.Model(&models.Permission{}).Count(&permissions)
+	db.Model(&models.Role{}).Count(&roles)
+	db.Table("role_permissions").Count(&grants)
+	if permissions != 9 || roles != 3 || grants != 1+7+2 {
+		t.Errorf("after two seeds: %d permissions, %d roles, %d grants", permissions, roles, grants)
+	}
+}
+
+// Roles edited through the admin service are not reset by a later seed
+func TestSeedKeepsEditedRoles(t *testing.T) {
+	db := newTestDB(t)
+	if err := seed(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var support models.Role
+	if err := db.Where("name = ?", RoleSupport).First(&support).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&support).Association("Permissions").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&support).Update("rank", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seed(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := rolePermissions(t, db)[RoleSupport]; len(got) != 0 {
+		t.Errorf("support permissions restored: %v", got)
+	}
+	if err := db.First(&support, support.ID).Error; err != nil || support.Rank != 20 {
+		t.Errorf("support rank = %d, %v", support.Rank, err)
+	}
+}
@@ -0,0 +1,188 @@
+// pkg/rbac/rbac.go
+package rbac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/cache"
+	"github.com/walletYabPangu/shared/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnauthenticated = errors.New("rbac: no authenticated user")
+	ErrForbidden       = errors.New("rbac: permission denied")
+)
+
+// Built-in roles, seeded by Migrate
+const (
+	RoleOwner   = "owner"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Permissions checked by the admin service
+const (
+	PermAll                  = "*"
+	PermUserRead             = "user:read"
+	PermUserBan              = "user:ban"
+	PermTaskWrite            = "task:write"
+	PermSkinWrite            = "skin:write"
+	PermFishTypeWrite        = "fish_type:write"
+	PermServiceRegistryWrite = "service_registry:write"
+	PermAuditRead            = "audit:read"
+	PermRoleManage           = "role:manage"
+)
+
+const (
+	rolePermissionsCacheKey = "rbac:role_permissions"
+	rolePermissionsTTL      = 5 * time.Minute
+)
+
+// roleGrants maps role name to its permission codes and rank
+type roleGrants map[string]struct {
+	Rank        int      `json:"rank"`
+	Permissions []string `json:"permissions"`
+}
+
+type Authorizer struct {
+	db    *gorm.DB
+	cache *cache.Cache
+}
+
+// New creates an Authorizer. The role table is cached through c when
+// it is not nil; call Invalidate after editing roles.
+func New(db *gorm.DB, c *cache.Cache) *Authorizer {
+	return &Authorizer{db: db, cache: c}
+}
+
+func (a *Authorizer) grants(ctx context.Context) (roleGrants, error) {
+	load := func() (interface{}, error) {
+		var roles []models.Role
+		if err := a.db.WithContext(ctx).Preload("Permissions").Find(&roles).Error; err != nil {
+			return nil, err
+		}
+
+		g := make(roleGrants, len(roles))
+		for _, r := range roles {
+			entry := g[r.Name]
+			entry.Rank = r.Rank
+			for _, p := range r.Permissions {
+				entry.Permissions = append(entry.Permissions, p.Code)
+			}
+			g[r.Name] = entry
+		}
+		return g, nil
+	}
+
+	if a.cache == nil {
+		g, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return g.(roleGrants), nil
+	}
+
+	var g roleGrants
+	if err := a.cache.GetOrSet(ctx, rolePermissionsCacheKey, rolePermissionsTTL, load, &g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Invalidate drops the cached role table
+func (a *Authorizer) Invalidate(ctx context.Context) error {
+	if a.cache == nil {
+		return nil
+	}
+	return a.cache.Delete(ctx, rolePermissionsCacheKey)
+}
+
+// Can reports whether any of roles grants permission
+func (a *Authorizer) Can(ctx context.Context, roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	g, err := a.grants(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		for _, p := range g[role].Permissions {
+			if p == permission || p == PermAll {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Check verifies permission for the user authenticated on ctx
+func (a *Authorizer) Check(ctx context.Context, permission string) error {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	allowed, err := a.Can(ctx, claims.Roles, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Require is an http middleware allowing only users granted permission.
+// It must run after middleware.Authenticate.
+func (a *Authorizer) Require(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch err := a.Check(r.Context(), permission); {
+			case err == nil:
+				next.ServeHTTP(w, r)
+			case errors.Is(err, ErrUnauthenticated):
+				middleware.WriteError(w, http.StatusUnauthorized, middleware.CodeUnauthorized, "authentication required")
+			case errors.Is(err, ErrForbidden):
+				middleware.WriteError(w, http.StatusForbidden, middleware.CodeForbidden, "missing permission "+permission)
+			default:
+				middleware.WriteError(w, http.StatusInternalServerError, middleware.CodeInternal, "cannot check permissions")
+			}
+		})
+	}
+}
+
+// UserRoles returns the role names to embed in the user's access token
+func (a *Authorizer) UserRoles(ctx context.Context, userID uint64) ([]string, error) {
+	var names []string
+	err := a.db.WithContext(ctx).
+		Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// ActorType returns the value to record in AuditLog.ActorType for an
+// actor holding roles: the highest ranked role, or "user".
+func (a *Authorizer) ActorType(ctx context.Context, roles []string) string {
+	g, err := a.grants(ctx)
+	if err != nil {
+		return models.ActorTypeUser
+	}
+
+	actor, best := models.ActorTypeUser, -1
+	for _, role := range roles {
+		if entry, ok := g[role]; ok && entry.Rank > best {
+			actor, best = role, entry.Rank
+		}
+	}
+	return actor
+}
@@ -0,0 +1,151 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/walletYabPangu/shared"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/middleware"
+	"github.com/walletYabPangu/shared/types"
+)
+
+func newTestAuthorizer(t *testing.T) *Authorizer {
+	t.Helper()
+	db := newTestDB(t)
+	if err := seed(db); err != nil {
+		t.Fatal(err)
+	}
+	return New(db, nil)
+}
+
+func TestCan(t *testing.T) {
+	a := newTestAuthorizer(t)
+	tests := []struct {
+		name       string
+		roles      []string
+		permission string
+		want       bool
+	}{
+		{"owner has everything", []string{RoleOwner}, PermRoleManage, true},
+		{"admin", []string{RoleAdmin}, PermTaskWrite, true},
+		{"admin cannot manage roles", []string{RoleAdmin}, PermRoleManage, false},
+		{"support bans", []string{RoleSupport}, PermUserBan, true},
+		{"support cannot edit tasks", []string{RoleSupport}, PermTaskWrite, false},
+		{"any role granting is enough", []string{RoleSupport, RoleAdmin}, PermAuditRead, true},
+		{"unknown role", []string{"intern"}, PermUserRead, false},
+		{"no roles", nil, PermUserRead, false},
+		{"unknown permission", []string{RoleAdmin}, "wallet:drain", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Can(context.Background(), tt.roles, tt.permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Can(%v, %s) = %v, want %v", tt.roles, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	a := newTestAuthorizer(t)
+	j := shared.JwtNew("0123456789abcdef0123456789abcdef")
+	token := func(roles ...string) string {
+		tok, err := j.GenerateToken(42, 1042, roles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + tok
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		h      http.Handler
+		auth   string
+		status int
+		code   string
+	}{
+		{"granted", middleware.Authenticate(j)(a.Require(PermUserBan)(ok)), token(RoleSupport), http.StatusNoContent, ""},
+		{"no claims", a.Require(PermUserBan)(ok), "", http.StatusUnauthorized, middleware.CodeUnauthorized},
+		{"missing permission", middleware.Authenticate(j)(a.Require(PermRoleManage)(ok)), token(RoleAdmin), http.StatusForbidden, middleware.CodeForbidden},
+		{"no roles", middleware.Authenticate(j)(a.Require(PermUserRead)(ok)), token(), http.StatusForbidden, middleware.CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/users/7/ban", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.code == "" {
+				return
+			}
+			var body types.APIError
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Code != tt.code {
+				t.Errorf("body = %+v, %v; want code %s", body, err, tt.code)
+			}
+		})
+	}
+
+	// The role store is down: neither allow nor blame the user
+	sqlDB, _ := a.db.DB()
+	_ = sqlDB.Close()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/admin/users/7/ban", nil)
+	r.Header.Set("Authorization", token(RoleOwner))
+	middleware.Authenticate(j)(a.Require(PermUserBan)(ok)).ServeHTTP(w, r)
+	var body types.APIError
+	if w.Code != http.StatusInternalServerError || json.NewDecoder(w.Body).Decode(&body) != nil || body.Code != middleware.CodeInternal {
+		t.Errorf("store error: status %d, body %+v", w.Code, body)
+	}
+}
+
+func TestActorType(t *testing.T) {
+	a := newTestAuthorizer(t)
+	tests := []struct {
+		roles []string
+		want  string
+	}{
+		{[]string{RoleSupport, RoleOwner, RoleAdmin}, RoleOwner},
+		{[]string{RoleSupport, RoleAdmin}, RoleAdmin},
+		{[]string{RoleSupport}, RoleSupport},
+		{[]string{"intern"}, models.ActorTypeUser},
+		{nil, models.ActorTypeUser},
+	}
+	for _, tt := range tests {
+		if got := a.ActorType(context.Background(), tt.roles); got != tt.want {
+			t.Errorf("ActorType(%v) = %s, want %s", tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	a := newTestAuthorizer(t)
+	var admin models.Role
+	if err := a.db.Where("name = ?", RoleAdmin).First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.db.Omit("User", "Role").Create(&models.UserRole{UserID: 42, RoleID: admin.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	roles, err := a.UserRoles(context.Background(), 42)
+	if err != nil || len(roles) != 1 || roles[0] != RoleAdmin {
+		t.Errorf("UserRoles(42) = %v, %v", roles, err)
+	}
+	if roles, err := a.UserRoles(context.Background(), 43); err != nil || len(roles) != 0 {
+		t.Errorf("UserRoles(43) = %v, %v", roles, err)
+	}
+}
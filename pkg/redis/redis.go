@@ -3,34 +3,107 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"github.com/walletYabPangu/shared/config"
+	"net"
+	"os"
 	"time"
 )
 
+// Client works the same against a single node, a sentinel failover
+// group or a cluster; the deployment is chosen by the config.
 type Client struct {
-	*redis.Client
+	redis.UniversalClient
 }
 
 func New(cfg config.RedisConfig) (*Client, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
-		Password:     cfg.Password,
-		DB:           cfg.DB,
-		PoolSize:     cfg.PoolSize,
-		MinIdleConns: cfg.MinIdleConns,
-	})
+	opts, err := Options(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewUniversalClient(opts)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("redis ping failed: %w", err)
+		_ = client.Close()
+		return nil, fmt.Errorf("redis ping failed (%s): %w", cfg.Mode(), err)
+	}
+
+	return &Client{UniversalClient: client}, nil
+}
+
+// Options translates cfg into go-redis options
+func Options(cfg config.RedisConfig) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Username:        cfg.Username,
+		Password:        cfg.Password,
+		DB:              cfg.DB,
+		PoolSize:        cfg.PoolSize,
+		MinIdleConns:    cfg.MinIdleConns,
+		DialTimeout:     cfg.DialTimeout,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		MaxRetries:      cfg.MaxRetries,
+		MinRetryBackoff: cfg.MinRetryBackoff,
+		MaxRetryBackoff: cfg.MaxRetryBackoff,
 	}
 
-	return &Client{Client: client}, nil
+	switch cfg.Mode() {
+	case config.RedisModeCluster:
+		opts.Addrs = cfg.ClusterAddrs
+		// A single address is a cluster configuration endpoint
+		opts.IsClusterMode = true
+	case config.RedisModeSentinel:
+		opts.Addrs = cfg.SentinelAddrs
+		opts.MasterName = cfg.SentinelMaster
+		opts.SentinelPassword = cfg.SentinelPassword
+	default:
+		opts.Addrs = []string{net.JoinHostPort(cfg.Host, cfg.Port)}
+	}
+
+	if cfg.TLSEnabled {
+		tlsConfig, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+func tlsConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCACert != "" {
+		pem, err := os.ReadFile(cfg.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis tls: no certificates in %s", cfg.TLSCACert)
+		}
+		tc.RootCAs = pool
+	}
+
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
 }
 
 // Helper methods
@@ -0,0 +1,205 @@
+// pkg/reqctx/reqctx.go
+package reqctx
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Headers (and message metadata keys) used to propagate the context
+// between services. Roles have no header: they are only set from a
+// verified token in this process, never taken from a caller.
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderUserID      = "X-User-ID"
+	HeaderTelegramID  = "X-Telegram-ID"
+	HeaderService     = "X-Caller-Service"
+	HeaderTraceParent = "traceparent"
+)
+
+type key int
+
+const (
+	requestIDKey key = iota
+	userIDKey
+	telegramIDKey
+	serviceKey
+	rolesKey
+	traceKey
+)
+
+// Trace identifies the distributed trace a request belongs to, in the
+// W3C Trace Context format
+type Trace struct {
+	TraceID string // 32 hex characters
+	SpanID  string // 16 hex characters
+	Sampled bool
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+func WithUserID(ctx context.Context, userID uint64) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserID returns the user the request acts for. Behind RequireService
+// it is whatever the calling service sent, so use it for logging and
+// correlation only.
+func UserID(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(userIDKey).(uint64)
+	return id, ok && id != 0
+}
+
+func WithTelegramID(ctx context.Context, telegramID int64) context.Context {
+	return context.WithValue(ctx, telegramIDKey, telegramID)
+}
+
+func TelegramID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(telegramIDKey).(int64)
+	return id, ok && id != 0
+}
+
+// WithService records the service that sent the request. Senders set
+// their own name before Inject; receivers get the caller's.
+func WithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceKey, service)
+}
+
+func Service(ctx context.Context) (string, bool) {
+	svc, ok := ctx.Value(serviceKey).(string)
+	return svc, ok && svc != ""
+}
+
+// WithRoles records the roles of the authenticated user. Unlike the
+// other values they are not propagated by ToMetadata or InjectHTTP.
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesKey, roles)
+}
+
+func Roles(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesKey).([]string)
+	return roles
+}
+
+func WithTrace(ctx context.Context, t Trace) context.Context {
+	return context.WithValue(ctx, traceKey, t)
+}
+
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	t, ok := ctx.Value(traceKey).(Trace)
+	return t, ok && t.TraceID != ""
+}
+
+// ToMetadata returns every value set on ctx keyed by header name, for
+// message metadata (queue headers, outbox rows)
+func ToMetadata(ctx context.Context) map[string]string {
+	md := map[string]string{}
+	if id, ok := RequestID(ctx); ok {
+		md[HeaderRequestID] = id
+	}
+	if id, ok := UserID(ctx); ok {
+		md[HeaderUserID] = strconv.FormatUint(id, 10)
+	}
+	if id, ok := TelegramID(ctx); ok {
+		md[HeaderTelegramID] = strconv.FormatInt(id, 10)
+	}
+	if svc, ok := Service(ctx); ok {
+		md[HeaderService] = svc
+	}
+	if t, ok := TraceFromContext(ctx); ok {
+		md[HeaderTraceParent] = t.String()
+	}
+	return md
+}
+
+// FromMetadata restores the values written by ToMetadata. Malformed
+// entries are skipped. The values are trusted as given, so only use
+// it for messages and requests from authenticated services.
+func FromMetadata(ctx context.Context, md map[string]string) context.Context {
+	if id := md[HeaderRequestID]; id != "" && len(id) <= 128 {
+		ctx = WithRequestID(ctx, id)
+	}
+	if id, err := strconv.ParseUint(md[HeaderUserID], 10, 64); err == nil && id != 0 {
+		ctx = WithUserID(ctx, id)
+	}
+	if id, err := strconv.ParseInt(md[HeaderTelegramID], 10, 64); err == nil && id != 0 {
+		ctx = WithTelegramID(ctx, id)
+	}
+	if svc := md[HeaderService]; svc != "" {
+		ctx = WithService(ctx, svc)
+	}
+	if t, ok := ParseTraceParent(md[HeaderTraceParent]); ok {
+		ctx = WithTrace(ctx, t)
+	}
+	return ctx
+}
+
+// InjectHTTP sets the propagation headers on an outgoing request
+func InjectHTTP(ctx context.Context, h http.Header) {
+	for k, v := range ToMetadata(ctx) {
+		h.Set(k, v)
+	}
+}
+
+// ExtractHTTP reads the propagation headers of an incoming request.
+// Like FromMetadata it trusts them; use it only behind service
+// authentication, never on public endpoints.
+func ExtractHTTP(ctx context.Context, h http.Header) context.Context {
+	md := make(map[string]string, 5)
+	for _, k := range []string{HeaderRequestID, HeaderUserID, HeaderTelegramID, HeaderService, HeaderTraceParent} {
+		if v := h.Get(k); v != "" {
+			md[k] = v
+		}
+	}
+	return FromMetadata(ctx, md)
+}
+
+// ParseTraceParent reads a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(s string) (Trace, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return Trace{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || !isHex(flags, 2) {
+		return Trace{}, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return Trace{}, false
+	}
+
+	f, _ := hex.DecodeString(flags)
+	return Trace{TraceID: traceID, SpanID: spanID, Sampled: f[0]&1 == 1}, true
+}
+
+// String formats the trace as a traceparent header
+func (t Trace) String() string {
+	flags := "00"
+	if t.Sampled {
+		flags = "01"
+	}
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + flags
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package reqctx
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Trace
+		ok   bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Trace{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true}, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", Trace{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false}, true},
+		// later versions may append fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03-extra", Trace{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true}, true},
+		{"", Trace{}, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Trace{}, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", Trace{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", Trace{}, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", Trace{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", Trace{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", Trace{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTraceParent(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseTraceParent(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+		if ok && tt.in[:2] == "00" && got.String() != tt.in {
+			t.Errorf("String() = %q, want %q", got.String(), tt.in)
+		}
+	}
+}
+
+func fullContext() context.Context {
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithUserID(ctx, 42)
+	ctx = WithTelegramID(ctx, 1042)
+	ctx = WithService(ctx, "auth")
+	ctx = WithRoles(ctx, []string{"admin"})
+	trace, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	return WithTrace(ctx, trace)
+}
+
+func assertPropagated(t *testing.T, ctx context.Context) {
+	t.Helper()
+	if id, _ := RequestID(ctx); id != "req-1" {
+		t.Errorf("request ID = %q", id)
+	}
+	if id, _ := UserID(ctx); id != 42 {
+		t.Errorf("user ID = %d", id)
+	}
+	if id, _ := TelegramID(ctx); id != 1042 {
+		t.Errorf("telegram ID = %d", id)
+	}
+	if svc, _ := Service(ctx); svc != "auth" {
+		t.Errorf("service = %q", svc)
+	}
+	if tr, _ := TraceFromContext(ctx); tr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || !tr.Sampled {
+		t.Errorf("trace = %+v", tr)
+	}
+	// Roles come only from a verified token, never from a caller
+	if roles := Roles(ctx); roles != nil {
+		t.Errorf("roles propagated: %v", roles)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	md := ToMetadata(fullContext())
+	want := map[string]string{
+		HeaderRequestID:   "req-1",
+		HeaderUserID:      "42",
+		HeaderTelegramID:  "1042",
+		HeaderService:     "auth",
+		HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Fatalf("ToMetadata = %v, want %v", md, want)
+	}
+	assertPropagated(t, FromMetadata(context.Background(), md))
+
+	if md := ToMetadata(context.Background()); len(md) != 0 {
+		t.Errorf("empty context gave %v", md)
+	}
+}
+
+func TestFromMetadataSkipsMalformed(t *testing.T) {
+	ctx := FromMetadata(context.Background(), map[string]string{
+		HeaderRequestID:   string(make([]byte, 129)),
+		HeaderUserID:      "-1",
+		HeaderTelegramID:  "abc",
+		HeaderTraceParent: "garbage",
+		"X-User-Roles":    "admin",
+	})
+	if md := ToMetadata(ctx); len(md) != 0 {
+		t.Errorf("malformed metadata restored %v", md)
+	}
+	if roles := Roles(ctx); roles != nil {
+		t.Errorf("roles restored: %v", roles)
+	}
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	h := http.Header{}
+	InjectHTTP(fullContext(), h)
+	if h.Get("X-User-Roles") != "" {
+		t.Error("roles sent as a header")
+	}
+
+	h.Set("X-User-Roles", "admin")
+	assertPropagated(t, ExtractHTTP(context.Background(), h))
+}
@@ -0,0 +1,163 @@
+// pkg/telegram/webapp.go
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walletYabPangu/shared/config"
+	"github.com/walletYabPangu/shared/models"
+)
+
+var (
+	ErrInitDataMalformed   = errors.New("telegram: init data is malformed")
+	ErrInitDataMissingHash = errors.New("telegram: init data has no hash")
+	ErrInitDataInvalidHash = errors.New("telegram: init data hash mismatch")
+	ErrInitDataExpired     = errors.New("telegram: init data is expired")
+	ErrInitDataFuture      = errors.New("telegram: init data is from the future")
+	ErrNoBotToken          = errors.New("telegram: bot token is required")
+)
+
+const (
+	defaultInitDataMaxAge = 24 * time.Hour
+
+	// initDataClockSkew is how far auth_date may lie in the future
+	initDataClockSkew = time.Minute
+)
+
+// Identity is the user described by a verified Mini App init data string
+type Identity struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username,omitempty"`
+	FirstName    string    `json:"first_name,omitempty"`
+	LastName     string    `json:"last_name,omitempty"`
+	LanguageCode string    `json:"language_code,omitempty"`
+	IsPremium    bool      `json:"is_premium,omitempty"`
+	PhotoURL     string    `json:"photo_url,omitempty"`
+	StartParam   string    `json:"start_param,omitempty"`
+	AuthDate     time.Time `json:"auth_date"`
+}
+
+// ApplyTo copies the Telegram profile onto u, leaving fields the
+// client did not send untouched. Use it before upserting the user.
+func (id *Identity) ApplyTo(u *models.User) {
+	u.TelegramID = id.ID
+	u.IsPremium = id.IsPremium
+	if id.Username != "" {
+		u.Username = &id.Username
+	}
+	if id.FirstName != "" {
+		u.FirstName = &id.FirstName
+	}
+	if id.LastName != "" {
+		u.LastName = &id.LastName
+	}
+	if id.LanguageCode != "" {
+		u.LanguageCode = id.LanguageCode
+	}
+	if id.PhotoURL != "" {
+		u.ProfilePhotoURL = &id.PhotoURL
+	}
+}
+
+type Validator struct {
+	secret []byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewValidator creates a validator for the bot configured in cfg.
+// Init data older than maxAge is rejected; zero means 24h. It fails
+// without a bot token, which would make init data forgeable.
+func NewValidator(cfg config.BotConfig, maxAge time.Duration) (*Validator, error) {
+	if cfg.Token == "" {
+		return nil, ErrNoBotToken
+	}
+	if maxAge <= 0 {
+		maxAge = defaultInitDataMaxAge
+	}
+
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(cfg.Token))
+
+	return &Validator{secret: mac.Sum(nil), maxAge: maxAge, now: time.Now}, nil
+}
+
+// Validate checks the hash and freshness of the raw init data string
+// (Telegram.WebApp.initData) and returns the identity it carries.
+func (v *Validator) Validate(initData string) (*Identity, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInitDataMalformed, err)
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, ErrInitDataMissingHash
+	}
+	expected, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, ErrInitDataInvalidHash
+	}
+
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(dataCheckString(values)))
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, ErrInitDataInvalidHash
+	}
+
+	authUnix, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid auth_date", ErrInitDataMalformed)
+	}
+	authDate := time.Unix(authUnix, 0)
+	age := v.now().Sub(authDate)
+	if age > v.maxAge {
+		return nil, ErrInitDataExpired
+	}
+	if age < -initDataClockSkew {
+		return nil, ErrInitDataFuture
+	}
+
+	rawUser := values.Get("user")
+	if rawUser == "" {
+		return nil, fmt.Errorf("%w: no user", ErrInitDataMalformed)
+	}
+	identity := &Identity{}
+	if err := json.Unmarshal([]byte(rawUser), identity); err != nil {
+		return nil, fmt.Errorf("%w: invalid user: %v", ErrInitDataMalformed, err)
+	}
+	if identity.ID == 0 {
+		return nil, fmt.Errorf("%w: user has no id", ErrInitDataMalformed)
+	}
+	identity.StartParam = values.Get("start_param")
+	identity.AuthDate = authDate
+
+	return identity, nil
+}
+
+// dataCheckString joins every field except hash as sorted key=value lines
+func dataCheckString(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+values.Get(k))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,107 @@
+package telegram
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/walletYabPangu/shared/config"
+)
+
+const (
+	testBotToken = "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+
+	// Signed with testBotToken per the Mini App documentation
+	testInitData = "query_id=AAHdF6IQAAAAAN0XohDhrOrc" +
+		"&user=%7B%22id%22%3A279058397%2C%22first_name%22%3A%22Vladislav%22%2C%22last_name%22%3A%22Kibenko%22%2C%22username%22%3A%22vdkfrost%22%2C%22language_code%22%3A%22ru%22%2C%22is_premium%22%3Atrue%7D" +
+		"&auth_date=1760000000&start_param=ref42" +
+		"&hash=471fa9c30fb001e80bce8401a743e5c1ee1aae0f5b8a30cb5c940c97dbeba337"
+)
+
+var testAuthDate = time.Unix(1760000000, 0)
+
+func newTestValidator(t *testing.T, now time.Time) *Validator {
+	t.Helper()
+	v, err := NewValidator(config.BotConfig{Token: testBotToken}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	v := newTestValidator(t, testAuthDate.Add(time.Minute))
+
+	id, err := v.Validate(testInitData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != 279058397 || id.Username != "vdkfrost" || !id.IsPremium || id.StartParam != "ref42" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if !id.AuthDate.Equal(testAuthDate) {
+		t.Errorf("auth date %v, want %v", id.AuthDate, testAuthDate)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tampered := strings.Replace(testInitData, "ref42", "ref43", 1)
+	badHash := strings.Replace(testInitData, "hash=471f", "hash=471e", 1)
+	noHash := testInitData[:strings.Index(testInitData, "&hash=")]
+
+	tests := []struct {
+		name     string
+		initData string
+		now      time.Time
+		want     error
+	}{
+		{"tampered field", tampered, testAuthDate, ErrInitDataInvalidHash},
+		{"tampered hash", badHash, testAuthDate, ErrInitDataInvalidHash},
+		{"missing hash", noHash, testAuthDate, ErrInitDataMissingHash},
+		{"expired", testInitData, testAuthDate.Add(time.Hour + time.Second), ErrInitDataExpired},
+		{"future", testInitData, testAuthDate.Add(-2 * time.Minute), ErrInitDataFuture},
+		{"malformed", "%zz", testAuthDate, ErrInitDataMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestValidator(t, tt.now).Validate(tt.initData)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithinSkew(t *testing.T) {
+	v := newTestValidator(t, testAuthDate.Add(-30*time.Second))
+	if _, err := v.Validate(testInitData); err != nil {
+		t.Fatalf("auth_date within clock skew rejected: %v", err)
+	}
+}
+
+func TestValidateOtherBot(t *testing.T) {
+	v, err := NewValidator(config.BotConfig{Token: "987654321:other"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testAuthDate }
+	if _, err := v.Validate(testInitData); !errors.Is(err, ErrInitDataInvalidHash) {
+		t.Fatalf("got %v, want ErrInitDataInvalidHash", err)
+	}
+}
+
+func TestNewValidatorRequiresToken(t *testing.T) {
+	if _, err := NewValidator(config.BotConfig{}, 0); !errors.Is(err, ErrNoBotToken) {
+		t.Fatalf("got %v, want ErrNoBotToken", err)
+	}
+}
+
+func TestDataCheckString(t *testing.T) {
+	values, _ := url.ParseQuery("b=2&hash=x&a=1")
+	if got := dataCheckString(values); got != "a=1\nb=2" {
+		t.Errorf("got %q", got)
+	}
+}
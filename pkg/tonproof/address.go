@@ -0,0 +1,110 @@
+// pkg/tonproof/address.go
+package tonproof
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAddress = errors.New("tonproof: invalid address")
+
+const (
+	flagBounceable    = 0x11
+	flagNonBounceable = 0x51
+	flagTestOnly      = 0x80
+)
+
+// Address is a TON account address: workchain plus 256-bit account hash
+type Address struct {
+	Workchain int32
+	Hash      [32]byte
+}
+
+// ParseAddress accepts the raw form ("0:<hex>") and the user-friendly
+// base64 or base64url forms, bounceable or not.
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if wc, hash, ok := strings.Cut(s, ":"); ok {
+		return parseRawAddress(wc, hash)
+	}
+	return parseFriendlyAddress(s)
+}
+
+func parseRawAddress(wc, hash string) (Address, error) {
+	var a Address
+
+	w, err := strconv.ParseInt(wc, 10, 32)
+	if err != nil {
+		return a, fmt.Errorf("%w: workchain %q", ErrInvalidAddress, wc)
+	}
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) != 32 {
+		return a, fmt.Errorf("%w: account hash", ErrInvalidAddress)
+	}
+
+	a.Workchain = int32(w)
+	copy(a.Hash[:], b)
+	return a, nil
+}
+
+func parseFriendlyAddress(s string) (Address, error) {
+	var a Address
+
+	s = strings.NewReplacer("-", "+", "_", "/").Replace(s)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 36 {
+		return a, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	if binary.BigEndian.Uint16(b[34:]) != crc16(b[:34]) {
+		return a, fmt.Errorf("%w: checksum mismatch", ErrInvalidAddress)
+	}
+	if tag := b[0] &^ flagTestOnly; tag != flagBounceable && tag != flagNonBounceable {
+		return a, fmt.Errorf("%w: unknown tag %#x", ErrInvalidAddress, b[0])
+	}
+
+	a.Workchain = int32(int8(b[1]))
+	copy(a.Hash[:], b[2:34])
+	return a, nil
+}
+
+// String returns the raw form, the normalized value stored on users
+func (a Address) String() string {
+	return strconv.Itoa(int(a.Workchain)) + ":" + hex.EncodeToString(a.Hash[:])
+}
+
+// UserFriendly returns the base64url form shown by wallets
+func (a Address) UserFriendly(bounceable, testnet bool) string {
+	b := make([]byte, 36)
+	b[0] = flagNonBounceable
+	if bounceable {
+		b[0] = flagBounceable
+	}
+	if testnet {
+		b[0] |= flagTestOnly
+	}
+	b[1] = byte(int8(a.Workchain))
+	copy(b[2:34], a.Hash[:])
+	binary.BigEndian.PutUint16(b[34:], crc16(b[:34]))
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// crc16 is CRC-16/XMODEM as used by user-friendly addresses
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,221 @@
+// pkg/tonproof/cell.go
+package tonproof
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Just enough of the TVM cell format to hash a wallet state-init and
+// read the public key from its data cell. Exotic cells are rejected.
+
+var ErrInvalidBOC = errors.New("tonproof: invalid bag of cells")
+
+const bocMagic = 0xb5ee9c72
+
+type cell struct {
+	data   []byte // d2-padded bytes exactly as serialized
+	bitLen int
+	refs   []*cell
+
+	hash  *[32]byte
+	depth int
+}
+
+// bits returns n bits starting at offset as a byte slice, left aligned
+func (c *cell) bits(offset, n int) ([]byte, error) {
+	if offset+n > c.bitLen {
+		return nil, fmt.Errorf("%w: read past end of cell", ErrInvalidBOC)
+	}
+	out := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		pos := offset + i
+		if c.data[pos/8]&(0x80>>(pos%8)) != 0 {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out, nil
+}
+
+func (c *cell) bit(offset int) (bool, error) {
+	b, err := c.bits(offset, 1)
+	if err != nil {
+		return false, err
+	}
+	return b[0] != 0, nil
+}
+
+// reprHash is the representation hash of an ordinary level-0 cell
+func (c *cell) reprHash() [32]byte {
+	if c.hash != nil {
+		return *c.hash
+	}
+
+	d1 := byte(len(c.refs))
+	d2 := byte(c.bitLen/8 + (c.bitLen+7)/8)
+
+	h := sha256.New()
+	h.Write([]byte{d1, d2})
+	h.Write(c.data)
+
+	for _, r := range c.refs {
+		r.reprHash()
+		if r.depth+1 > c.depth {
+			c.depth = r.depth + 1
+		}
+		var d [2]byte
+		binary.BigEndian.PutUint16(d[:], uint16(r.depth))
+		h.Write(d[:])
+	}
+	for _, r := range c.refs {
+		rh := r.reprHash()
+		h.Write(rh[:])
+	}
+
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	c.hash = &sum
+	return sum
+}
+
+// parseBOC decodes a serialized bag of cells and returns its first root
+func parseBOC(b []byte) (*cell, error) {
+	r := &bocReader{b: b}
+
+	if r.uint(4) != bocMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidBOC)
+	}
+	flags := r.byte()
+	hasIdx := flags&0x80 != 0
+	refSize := int(flags & 0x07)
+	offSize := int(r.byte())
+	if r.err != nil || refSize == 0 || refSize > 4 || offSize == 0 || offSize > 8 {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidBOC)
+	}
+
+	cellCount := r.uint(refSize)
+	rootCount := r.uint(refSize)
+	_ = r.uint(refSize) // absent cells
+	_ = r.uint(offSize) // total cells size
+	// Every cell takes at least 2 bytes and every root refSize, so counts
+	// beyond the input length are bogus; this also bounds the allocations
+	remaining := uint64(len(b) - r.pos)
+	if r.err != nil || rootCount == 0 || cellCount == 0 || cellCount > 1<<16 ||
+		rootCount > cellCount || cellCount*2 > remaining || rootCount*uint64(refSize) > remaining {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidBOC)
+	}
+
+	rootIdx := r.uint(refSize)
+	r.skip(int(rootCount-1) * refSize)
+	if hasIdx {
+		r.skip(int(cellCount) * offSize)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidBOC)
+	}
+
+	n := int(cellCount)
+	cells := make([]*cell, n)
+	refIdx := make([][]int, n)
+	for i := 0; i < n; i++ {
+		d1, d2 := r.byte(), r.byte()
+		if d1&0x08 != 0 || d1&0x10 != 0 || d1>>5 != 0 {
+			return nil, fmt.Errorf("%w: exotic or pre-hashed cells are not supported", ErrInvalidBOC)
+		}
+		refs := int(d1 & 0x07)
+		if refs > 4 {
+			return nil, fmt.Errorf("%w: too many refs", ErrInvalidBOC)
+		}
+
+		// d2 is a byte: convert before adding or 0xff wraps to 0
+		data := r.bytes((int(d2) + 1) / 2)
+		if r.err != nil {
+			return nil, fmt.Errorf("%w: truncated cell", ErrInvalidBOC)
+		}
+		bitLen := int(d2/2) * 8
+		if d2%2 == 1 {
+			if len(data) == 0 {
+				return nil, fmt.Errorf("%w: missing completion tag", ErrInvalidBOC)
+			}
+			bitLen = completedBitLen(data)
+			if bitLen < 0 {
+				return nil, fmt.Errorf("%w: missing completion tag", ErrInvalidBOC)
+			}
+		}
+
+		cells[i] = &cell{data: data, bitLen: bitLen}
+		for j := 0; j < refs; j++ {
+			idx := r.uint(refSize)
+			// Serialization order guarantees refs point forward
+			if r.err != nil || idx <= uint64(i) || idx >= cellCount {
+				return nil, fmt.Errorf("%w: bad reference", ErrInvalidBOC)
+			}
+			refIdx[i] = append(refIdx[i], int(idx))
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidBOC)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for _, idx := range refIdx[i] {
+			cells[i].refs = append(cells[i].refs, cells[idx])
+		}
+	}
+
+	if rootIdx >= cellCount {
+		return nil, fmt.Errorf("%w: bad root", ErrInvalidBOC)
+	}
+	return cells[rootIdx], nil
+}
+
+// completedBitLen strips the completion tag (a 1 bit followed by zeros)
+func completedBitLen(data []byte) int {
+	last := data[len(data)-1]
+	if last == 0 {
+		return -1
+	}
+	trailing := 0
+	for last&1 == 0 {
+		last >>= 1
+		trailing++
+	}
+	return len(data)*8 - trailing - 1
+}
+
+type bocReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// bytes returns the next n bytes; past the end or after an error it
+// returns nil and sets err, so callers check err once per step
+func (r *bocReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.b)-r.pos {
+		r.err = ErrInvalidBOC
+		return nil
+	}
+	out := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return out
+}
+
+func (r *bocReader) skip(n int) { r.bytes(n) }
+
+func (r *bocReader) byte() byte {
+	if b := r.bytes(1); len(b) == 1 {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *bocReader) uint(n int) uint64 {
+	var v uint64
+	for _, b := range r.bytes(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
@@ -0,0 +1,322 @@
+// pkg/tonproof/tonproof.go
+package tonproof
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/models"
+	"github.com/walletYabPangu/shared/pkg/redis"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDomainNotAllowed    = errors.New("tonproof: domain is not allowed")
+	ErrProofExpired        = errors.New("tonproof: proof timestamp is out of range")
+	ErrUnknownPayload      = errors.New("tonproof: payload is unknown or already used")
+	ErrStateInitRequired   = errors.New("tonproof: state_init is required")
+	ErrStateInitMismatch   = errors.New("tonproof: state_init does not match address")
+	ErrPublicKeyMismatch   = errors.New("tonproof: public key is not in wallet data")
+	ErrInvalidSignature    = errors.New("tonproof: signature is invalid")
+	ErrNetworkNotSupported = errors.New("tonproof: network is not supported")
+	ErrWalletInUse         = errors.New("tonproof: wallet is linked to another user")
+)
+
+const (
+	NetworkMainnet = "-239"
+	NetworkTestnet = "-3"
+
+	proofPrefix  = "ton-proof-item-v2/"
+	proofContext = "ton-connect"
+)
+
+// Request is the account and ton_proof returned by TON Connect
+type Request struct {
+	Address    string `json:"address"`
+	Network    string `json:"network"`
+	PublicKey  string `json:"public_key"`
+	WalletType string `json:"wallet_type"` // TON Connect device.appName
+	Proof      Proof  `json:"proof"`
+}
+
+type Proof struct {
+	Timestamp int64  `json:"timestamp"`
+	Domain    Domain `json:"domain"`
+	Signature string `json:"signature"`
+	Payload   string `json:"payload"`
+	StateInit string `json:"state_init"`
+}
+
+type Domain struct {
+	LengthBytes uint32 `json:"lengthBytes"`
+	Value       string `json:"value"`
+}
+
+// Result is a verified wallet ownership claim
+type Result struct {
+	Address    Address
+	PublicKey  ed25519.PublicKey
+	WalletType string
+	Signature  string
+	SignedAt   time.Time
+}
+
+type Config struct {
+	Domains      []string      // allowed app domains, e.g. "app.example.com"
+	MaxAge       time.Duration // max age of a proof, default 15m
+	PayloadTTL   time.Duration // lifetime of issued payloads, default 15m
+	AllowTestnet bool
+}
+
+type Verifier struct {
+	client *redis.Client
+	cfg    Config
+	now    func() time.Time
+}
+
+func New(client *redis.Client, cfg Config) *Verifier {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 15 * time.Minute
+	}
+	if cfg.PayloadTTL <= 0 {
+		cfg.PayloadTTL = 15 * time.Minute
+	}
+	return &Verifier{client: client, cfg: cfg, now: time.Now}
+}
+
+func payloadKey(payload string) string { return "tonproof:payload:" + payload }
+
+// GeneratePayload issues a single-use nonce for the client to sign
+func (v *Verifier) GeneratePayload(ctx context.Context) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	payload := hex.EncodeToString(b)
+
+	if err := v.client.Set(ctx, payloadKey(payload), 1, v.cfg.PayloadTTL).Err(); err != nil {
+		return "", err
+	}
+	return payload, nil
+}
+
+// Verify checks the proof and consumes its payload
+func (v *Verifier) Verify(ctx context.Context, req *Request) (*Result, error) {
+	switch req.Network {
+	case NetworkMainnet, "":
+	case NetworkTestnet:
+		if !v.cfg.AllowTestnet {
+			return nil, ErrNetworkNotSupported
+		}
+	default:
+		return nil, ErrNetworkNotSupported
+	}
+
+	if !v.domainAllowed(req.Proof.Domain) {
+		return nil, ErrDomainNotAllowed
+	}
+
+	signedAt := time.Unix(req.Proof.Timestamp, 0)
+	if age := v.now().Sub(signedAt); age > v.cfg.MaxAge || age < -time.Minute {
+		return nil, ErrProofExpired
+	}
+
+	addr, err := ParseAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := hex.DecodeString(req.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: malformed public key", ErrPublicKeyMismatch)
+	}
+	if err := checkStateInit(addr, req.Proof.StateInit, pub); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(req.Proof.Signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if !ed25519.Verify(pub, signedMessage(addr, req.Proof), sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Consume last so a forged proof cannot burn a legitimate nonce
+	n, err := v.client.Del(ctx, payloadKey(req.Proof.Payload)).Result()
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrUnknownPayload
+	}
+
+	return &Result{
+		Address:    addr,
+		PublicKey:  pub,
+		WalletType: req.WalletType,
+		Signature:  req.Proof.Signature,
+		SignedAt:   signedAt,
+	}, nil
+}
+
+func (v *Verifier) domainAllowed(d Domain) bool {
+	if int(d.LengthBytes) != len(d.Value) {
+		return false
+	}
+	for _, allowed := range v.cfg.Domains {
+		if d.Value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// signedMessage builds the digest the wallet signs:
+// sha256(0xffff ++ "ton-connect" ++ sha256(message))
+func signedMessage(addr Address, p Proof) []byte {
+	var msg bytes.Buffer
+	msg.WriteString(proofPrefix)
+	_ = binary.Write(&msg, binary.BigEndian, addr.Workchain)
+	msg.Write(addr.Hash[:])
+	_ = binary.Write(&msg, binary.LittleEndian, p.Domain.LengthBytes)
+	msg.WriteString(p.Domain.Value)
+	_ = binary.Write(&msg, binary.LittleEndian, uint64(p.Timestamp))
+	msg.WriteString(p.Payload)
+	msgHash := sha256.Sum256(msg.Bytes())
+
+	full := append([]byte{0xff, 0xff}, proofContext...)
+	full = append(full, msgHash[:]...)
+	sum := sha256.Sum256(full)
+	return sum[:]
+}
+
+// checkStateInit verifies the state-init hashes to the address and that
+// its data cell holds pub where wallet contracts v3, v4 and v5 keep it.
+func checkStateInit(addr Address, stateInit string, pub []byte) error {
+	if stateInit == "" {
+		return ErrStateInitRequired
+	}
+	raw, err := base64.StdEncoding.DecodeString(stateInit)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBOC, err)
+	}
+	root, err := parseBOC(raw)
+	if err != nil {
+		return err
+	}
+	if root.reprHash() != addr.Hash {
+		return ErrStateInitMismatch
+	}
+
+	data, err := stateInitData(root)
+	if err != nil {
+		return err
+	}
+
+	// v3/v4: seqno:32 subwallet:32 pubkey:256
+	// v5:    is_signature_allowed:1 seqno:32 wallet_id:32 pubkey:256
+	for _, offset := range []int{64, 65} {
+		if key, err := data.bits(offset, 256); err == nil && bytes.Equal(key, pub) {
+			return nil
+		}
+	}
+	return ErrPublicKeyMismatch
+}
+
+// stateInitData walks split_depth, special, code and data of a StateInit
+func stateInitData(root *cell) (*cell, error) {
+	pos := 0
+	next := func() (bool, error) {
+		set, err := root.bit(pos)
+		pos++
+		return set, err
+	}
+
+	if set, err := next(); err != nil {
+		return nil, err
+	} else if set {
+		pos += 5 // split_depth
+	}
+	if set, err := next(); err != nil {
+		return nil, err
+	} else if set {
+		pos += 2 // special
+	}
+
+	ref := 0
+	if hasCode, err := next(); err != nil {
+		return nil, err
+	} else if hasCode {
+		ref++
+	}
+
+	hasData, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if !hasData || ref >= len(root.refs) {
+		return nil, fmt.Errorf("%w: state_init has no data", ErrInvalidBOC)
+	}
+	return root.refs[ref], nil
+}
+
+// walletAddrIndex makes a wallet linkable to one user only, so two
+// concurrent links cannot both pass the check in LinkWallet. Postgres
+// reports its violations as unique_violation (23505).
+const walletAddrIndex = "idx_users_wallet_addr_unique"
+
+// LinkWallet writes a verified wallet onto the user in one transaction,
+// refusing addresses already linked to someone else.
+func LinkWallet(ctx context.Context, db *gorm.DB, userID uint64, res *Result) error {
+	addr := res.Address.String()
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).
+			Where("wallet_addr = ? AND id <> ?", addr, userID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrWalletInUse
+		}
+
+		updates := map[string]interface{}{
+			"wallet_addr":         addr,
+			"wallet_signature":    res.Signature,
+			"wallet_connected_at": time.Now(),
+			"updated_at":          time.Now(),
+		}
+		if walletType := res.WalletType; walletType != "" {
+			if len(walletType) > 20 {
+				walletType = walletType[:20]
+			}
+			updates["wallet_type"] = walletType
+		}
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == walletAddrIndex {
+			return ErrWalletInUse
+		}
+		return err
+	})
+}
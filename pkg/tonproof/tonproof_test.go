@@ -0,0 +1,230 @@
+package tonproof
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/walletYabPangu/shared/pkg/redis"
+)
+
+// Vectors signed with a fixed key by tongo's ton_proof implementation
+const (
+	vectorPublicKey = "775386d4ec8f180b19e1974e95dd9cc8892b2f4bfef4179985ec464535ebc0b6"
+	vectorPayload   = "0f4a1c6b5e8d2f7a9c3b1e0d4f6a8c2e"
+	vectorTimestamp = 1760000000
+	vectorDomain    = "app.example.com"
+)
+
+var vectors = []struct {
+	name      string
+	address   string
+	signature string
+	stateInit string
+}{
+	{
+		name:      "v4r2",
+		address:   "0:e802feda846b8531eb866b987be15d0b91aa8c20a982c4ff40ba5f077a5b11a9",
+		signature: "jDHTqweFw+V0+KydBq/QADZIgXaOXQ/ggz9nv/n6FVYwsjxlF9FuzGfB4PSyK1OneEMK7C4Zo+r5isjqx0wECA==",
+		stateInit: "te6ccgECFgEAAwQAAgE0AQIBFP8A9KQT9LzyyAsDAFEAAAAAKamjF3dThtTsjxgLGeGXTpXdnMiJKy9L/vQXmYXsRkU168C2QAIBIAQFAgFIBgcE+PKDCNcYINMf0x/THwL4I7vyZO1E0NMf0x/T//QE0VFDuvKhUVG68qIF+QFUEGT5EPKj+AAkpMjLH1JAyx9SMMv/UhD0AMntVPgPAdMHIcAAn2xRkyDXSpbTB9QC+wDoMOAhwAHjACHAAuMAAcADkTDjDQOkyMsfEssfy/8SExQVAubQAdDTAyFxsJJfBOAi10nBIJJfBOAC0x8hghBwbHVnvSKCEGRzdHK9sJJfBeAD+kAwIPpEAcjKB8v/ydDtRNCBAUDXIfQEMFyBAQj0Cm+hMbOSXwfgBdM/yCWCEHBsdWe6kjgw4w0DghBkc3RyupJfBuMNCAkCASAKCwB4AfoA9AQw+CdvIjBQCqEhvvLgUIIQcGx1Z4MesXCAGFAEywUmzxZY+gIZ9ADLaRfLH1Jgyz8gyYBA+wAGAIpQBIEBCPRZMO1E0IEBQNcgyAHPFvQAye1UAXKwjiOCEGRzdHKDHrFwgBhQBcsFUAPPFiP6AhPLassfyz/JgED7AJJfA+ICASAMDQBZvSQrb2omhAgKBrkPoCGEcNQICEekk30pkQzmkD6f+YN4EoAbeBAUiYcVnzGEAgFYDg8AEbjJftRNDXCx+AA9sp37UTQgQFA1yH0BDACyMoHy//J0AGBAQj0Cm+hMYAIBIBARABmtznaiaEAga5Drhf/AABmvHfaiaEAQa5DrhY/AAG7SB/oA1NQi+QAFyMoHFcv/ydB3dIAYyMsFywIizxZQBfoCFMtrEszMyXP7AMhAFIEBCPRR8qcCAHCBAQjXGPoA0z/IVCBHgQEI9FHyp4IQbm90ZXB0gBjIywXLAlAGzxZQBPoCFMtqEssfyz/Jc/sAAgBsgQEI1xj6ANM/MFIkgQEI9Fnyp4IQZHN0cnB0gBjIywXLAlAFzxZQA/oCE8tqyx8Syz/Jc/sAAAr0AMntVA==",
+	},
+	{
+		name:      "v3r2",
+		address:   "0:4c3c2125002c534046d357df0e56a94d4e00ba83346dd18bcca5d241e799f267",
+		signature: "Nofsb3nm9HJipUAGy6Z65BbJ9V6N8jgDakWdjuaohkUYBLfBprcqefFSS9Hql9q9hMpgdB1vTZEkFoZfzroXDQ==",
+		stateInit: "te6ccgEBAwEAoAACATQBAgDe/wAg3SCCAUyXuiGCATOcurGfcbDtRNDTH9MfMdcL/+ME4KTyYIMI1xgg0x/TH9Mf+CMTu/Jj7UTQ0x/TH9P/0VEyuvKhUUS68qIE+QFUEFX5EPKj+ACTINdKltMH1AL7AOjRAaTIyx/LH8v/ye1UAFAAAAAAKamjF3dThtTsjxgLGeGXTpXdnMiJKy9L/vQXmYXsRkU168C2",
+	},
+}
+
+func TestProofVectors(t *testing.T) {
+	pub, _ := hex.DecodeString(vectorPublicKey)
+	proof := Proof{
+		Timestamp: vectorTimestamp,
+		Domain:    Domain{LengthBytes: uint32(len(vectorDomain)), Value: vectorDomain},
+		Payload:   vectorPayload,
+	}
+
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			addr, err := ParseAddress(v.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkStateInit(addr, v.stateInit, pub); err != nil {
+				t.Fatalf("checkStateInit: %v", err)
+			}
+
+			sig, _ := base64.StdEncoding.DecodeString(v.signature)
+			if !ed25519.Verify(pub, signedMessage(addr, proof), sig) {
+				t.Fatal("signature does not verify")
+			}
+
+			tampered := proof
+			tampered.Payload = "other"
+			if ed25519.Verify(pub, signedMessage(addr, tampered), sig) {
+				t.Fatal("signature verifies for another payload")
+			}
+
+			other := append([]byte(nil), pub...)
+			other[0] ^= 1
+			if err := checkStateInit(addr, v.stateInit, other); !errors.Is(err, ErrPublicKeyMismatch) {
+				t.Fatalf("foreign key: got %v, want ErrPublicKeyMismatch", err)
+			}
+		})
+	}
+}
+
+func TestStateInitAddressMismatch(t *testing.T) {
+	pub, _ := hex.DecodeString(vectorPublicKey)
+	addr, _ := ParseAddress(vectors[0].address)
+	if err := checkStateInit(addr, vectors[1].stateInit, pub); !errors.Is(err, ErrStateInitMismatch) {
+		t.Fatalf("got %v, want ErrStateInitMismatch", err)
+	}
+}
+
+func TestParseBOCTruncated(t *testing.T) {
+	raw, _ := base64.StdEncoding.DecodeString(vectors[0].stateInit)
+	for n := 0; n < len(raw); n++ {
+		if _, err := parseBOC(raw[:n]); !errors.Is(err, ErrInvalidBOC) {
+			t.Fatalf("%d of %d bytes: got %v, want ErrInvalidBOC", n, len(raw), err)
+		}
+	}
+}
+
+func TestParseBOCMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		// d2 = 255 claimed 128 data bytes but used to read none
+		{"d2 255 without data", "b5ee9c720101010100000000ff"},
+		{"d2 255 short data", "b5ee9c720101010100000000ff0102"},
+		{"d2 odd without data", "b5ee9c72010101010000000001"},
+		{"cell count beyond input", "b5ee9c720101ff01000000"},
+		{"root count beyond cells", "b5ee9c7201010102000000000000"},
+		{"ref size zero", "b5ee9c720001010100000000"},
+		{"ref pointing back", "b5ee9c7201010101000000010000"},
+		{"bad magic", "b5ee9c73010101010000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parseBOC(raw); !errors.Is(err, ErrInvalidBOC) {
+				t.Fatalf("got %v, want ErrInvalidBOC", err)
+			}
+		})
+	}
+}
+
+// newTestVerifier accepts vectorDomain at vectorTimestamp + age, with
+// vectorPayload issued
+func newTestVerifier(t *testing.T, age time.Duration) (*Verifier, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := &redis.Client{UniversalClient: goredis.NewClient(&goredis.Options{Addr: srv.Addr()})}
+	t.Cleanup(func() { _ = client.Close() })
+
+	v := New(client, Config{Domains: []string{vectorDomain}})
+	v.now = func() time.Time { return time.Unix(vectorTimestamp, 0).Add(age) }
+	if err := srv.Set(payloadKey(vectorPayload), "1"); err != nil {
+		t.Fatal(err)
+	}
+	return v, srv
+}
+
+func vectorRequest() *Request {
+	return &Request{
+		Address:    vectors[0].address,
+		Network:    NetworkMainnet,
+		PublicKey:  vectorPublicKey,
+		WalletType: "tonkeeper",
+		Proof: Proof{
+			Timestamp: vectorTimestamp,
+			Domain:    Domain{LengthBytes: uint32(len(vectorDomain)), Value: vectorDomain},
+			Signature: vectors[0].signature,
+			Payload:   vectorPayload,
+			StateInit: vectors[0].stateInit,
+		},
+	}
+}
+
+func TestVerifyConsumesPayload(t *testing.T) {
+	ctx := context.Background()
+	v, srv := newTestVerifier(t, time.Minute)
+
+	res, err := v.Verify(ctx, vectorRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Address != mustAddress(t, vectors[0].address) {
+		t.Errorf("address = %s", res.Address)
+	}
+	if res.WalletType != "tonkeeper" || !res.SignedAt.Equal(time.Unix(vectorTimestamp, 0)) {
+		t.Errorf("result = %+v", res)
+	}
+	if srv.Exists(payloadKey(vectorPayload)) {
+		t.Error("payload was not consumed")
+	}
+
+	if _, err := v.Verify(ctx, vectorRequest()); !errors.Is(err, ErrUnknownPayload) {
+		t.Fatalf("replay: got %v, want ErrUnknownPayload", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		age    time.Duration
+		modify func(*Request)
+		want   error
+	}{
+		{"other domain", time.Minute, func(r *Request) {
+			r.Proof.Domain = Domain{LengthBytes: 12, Value: "evil.example"}
+		}, ErrDomainNotAllowed},
+		{"domain length mismatch", time.Minute, func(r *Request) {
+			r.Proof.Domain.LengthBytes++
+		}, ErrDomainNotAllowed},
+		{"stale timestamp", 16 * time.Minute, func(*Request) {}, ErrProofExpired},
+		{"future timestamp", -2 * time.Minute, func(*Request) {}, ErrProofExpired},
+		{"testnet", time.Minute, func(r *Request) { r.Network = NetworkTestnet }, ErrNetworkNotSupported},
+		{"forged signature", time.Minute, func(r *Request) {
+			r.Proof.Signature = vectors[1].signature
+		}, ErrInvalidSignature},
+		{"payload not signed", time.Minute, func(r *Request) {
+			r.Proof.Payload = "ffffffffffffffffffffffffffffffff"
+		}, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, srv := newTestVerifier(t, tt.age)
+			req := vectorRequest()
+			tt.modify(req)
+
+			if _, err := v.Verify(context.Background(), req); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			// A rejected proof must not burn the nonce of a legitimate one
+			if !srv.Exists(payloadKey(vectorPayload)) {
+				t.Error("payload consumed by a rejected proof")
+			}
+		})
+	}
+}
+
+func mustAddress(t *testing.T, s string) Address {
+	t.Helper()
+	addr, err := ParseAddress(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
@@ -0,0 +1,170 @@
+package shared
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/walletYabPangu/shared/config"
+)
+
+// serviceKeys holds a key pair per service; each service only gets
+// its own private key
+type serviceKeys map[string]ed25519.PrivateKey
+
+func newServiceKeys(t *testing.T, services ...string) serviceKeys {
+	t.Helper()
+	keys := serviceKeys{}
+	for _, svc := range services {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[svc] = private
+	}
+	return keys
+}
+
+// jwtFor builds the JWT of self: its own private key and the public
+// keys of everyone else
+func (k serviceKeys) jwtFor(t *testing.T, self string) *JWT {
+	t.Helper()
+	set, _ := NewKeySet()
+	for svc, private := range k {
+		key := NewEd25519PublicKey(ServiceKeyID(svc), private.Public().(ed25519.PublicKey))
+		if svc == self {
+			key = NewEd25519Key(ServiceKeyID(svc), private)
+		}
+		if err := set.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return JwtNew("0123456789abcdef0123456789abcdef", WithServiceKeys(set))
+}
+
+func TestServiceTokenRoundTrip(t *testing.T) {
+	keys := newServiceKeys(t, ServiceAuth, ServiceGame, ServiceUser)
+	auth, user := keys.jwtFor(t, ServiceAuth), keys.jwtFor(t, ServiceUser)
+
+	token, err := auth.GenerateServiceToken(ServiceAuth, ServiceUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := user.ParseServiceToken(context.Background(), token, ServiceUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Service != ServiceAuth {
+		t.Errorf("service = %q, want %q", claims.Service, ServiceAuth)
+	}
+
+	if _, err := user.ParseServiceToken(context.Background(), token, ServiceGame); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("token for user accepted by game: %v", err)
+	}
+	if _, err := auth.GenerateServiceToken(ServiceGame, ServiceUser); !errors.Is(err, ErrKeyVerifyOnly) {
+		t.Errorf("auth signed as game: %v", err)
+	}
+}
+
+// A service holding only its own key must not pass as another service
+func TestServiceTokenBoundToKey(t *testing.T) {
+	keys := newServiceKeys(t, ServiceAuth, ServiceGame, ServiceUser)
+	user := keys.jwtFor(t, ServiceUser)
+	now := time.Now()
+
+	claims := ServiceClaims{
+		Service: ServiceGame,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ServiceGame,
+			Audience:  jwt.ClaimStrings{ServiceUser},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+	tests := []struct {
+		name string
+		kid  string
+		want error
+	}{
+		// honest kid, so the signature verifies, but the claims lie
+		{"own kid", ServiceKeyID(ServiceAuth), ErrTokenInvalid},
+		// claimed kid, so the signature does not verify
+		{"claimed kid", ServiceKeyID(ServiceGame), ErrTokenSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := signWith(NewEd25519Key(tt.kid, keys[ServiceAuth]), claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := user.ParseServiceToken(context.Background(), token, ServiceUser); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceAndAccessTokensDoNotMix(t *testing.T) {
+	keys := newServiceKeys(t, ServiceAuth, ServiceUser)
+	auth, user := keys.jwtFor(t, ServiceAuth), keys.jwtFor(t, ServiceUser)
+	ctx := context.Background()
+
+	access, err := user.GenerateToken(42, 1042, []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.ParseServiceToken(ctx, access, ServiceUser); err == nil {
+		t.Error("ParseServiceToken accepted an access token")
+	}
+
+	service, err := auth.GenerateServiceToken(ServiceAuth, ServiceUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.ParseToken(ctx, service); err == nil {
+		t.Error("ParseToken accepted a service token")
+	}
+}
+
+func TestServiceKeysFromConfig(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaPrivate)
+	pemOf := func(der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+
+	cfg := config.JWTConfig{
+		ServicePrivateKey: pemOf(edDER),
+		ServicePublicKeys: map[string]string{ServiceGame: base64.StdEncoding.EncodeToString(edPublic)},
+	}
+	keys, err := serviceKeysFromConfig(ServiceAuth, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := keys.Get(ServiceKeyID(ServiceAuth)); err != nil || !key.CanSign() {
+		t.Errorf("own key = %v, %v", key, err)
+	}
+	if _, err := keys.Get(ServiceKeyID(ServiceGame)); err != nil {
+		t.Error(err)
+	}
+
+	// Peers only accept Ed25519, so an RSA key would sign tokens no one
+	// can verify
+	cfg.ServicePrivateKey = pemOf(rsaDER)
+	if _, err := serviceKeysFromConfig(ServiceAuth, cfg); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Errorf("RSA key: got %v, want ErrUnsupportedAlg", err)
+	}
+}